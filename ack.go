@@ -0,0 +1,68 @@
+package psst
+
+import (
+	"time"
+)
+
+// scheduleAck accounts for a newly received data segment, acknowledging it
+// immediately once MaxCumulativeAck segments are pending, or otherwise within
+// CumulativeAckTimeout unless outgoing data carries the ACK first
+func (self *conn) scheduleAck() {
+	self.rxUnacked++
+
+	if self.rxUnacked >= uint16(self.config.MaxCumulativeAck) {
+		self.sendAck()
+		return
+	}
+
+	if self.cumulativeAckTimer == nil {
+		timeout := millisToDuration(self.config.CumulativeAckTimeout)
+		self.cumulativeAckTimer = time.AfterFunc(timeout, self.cumulativeAckTimerExpired)
+	}
+}
+
+func (self *conn) cumulativeAckTimerExpired() {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	self.cumulativeAckTimer = nil
+	if self.state == StateOpen && self.rxUnacked > 0 {
+		self.sendAck()
+	}
+}
+
+// attachEaks adds the sequence numbers of buffered out of sequence segments
+// to an outgoing ACK segment
+func (self *conn) attachEaks(segment *segment) {
+	// As many as fit in a segment the route delivers
+	maxEaks := self.maxEaks(len(segment.Data))
+	if self.rxBuffer.Len() == 0 || maxEaks == 0 {
+		return
+	}
+
+	eakNumbers := make([]uint16, 0, min(self.rxBuffer.Len(), maxEaks))
+	for element := self.rxBuffer.Front(); element != nil && len(eakNumbers) < maxEaks; element = element.Next() {
+		eakNumbers = append(eakNumbers, element.Value.(*rxBufferEntry).SeqNumber)
+	}
+
+	segment.EAK = true
+	segment.VarHeader = &eakVarHeader{
+		EakNumbers: eakNumbers,
+	}
+}
+
+// maxOutOfSeq is the number of out of sequence segments that are buffered
+func (self *conn) maxOutOfSeq() int {
+	return int(min(uint16(self.config.MaxOutOfSeq), self.config.MaxOutstandingSegmentsSelf))
+}
+
+// acknowledged clears pending acknowledgements once an outgoing segment
+// carries the ACK
+func (self *conn) acknowledged() {
+	self.rxUnacked = 0
+
+	if self.cumulativeAckTimer != nil {
+		self.cumulativeAckTimer.Stop()
+		self.cumulativeAckTimer = nil
+	}
+}
@@ -0,0 +1,149 @@
+package psst
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCumulativeAck(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.MaxCumulativeAck = 3
+	conn.rxLastInSeq = 0
+
+	conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte{1}})
+	conn.receiveSegment(&segment{SeqNumber: 2, Data: []byte{2}})
+
+	if segments := transport.take(); len(segments) != 0 || conn.cumulativeAckTimer == nil {
+		t.Fatalf("Sent segments %v before reaching MaxCumulativeAck", segments)
+	}
+
+	conn.receiveSegment(&segment{SeqNumber: 3, Data: []byte{3}})
+
+	segments := transport.take()
+	if len(segments) != 1 || !segments[0].ACK || segments[0].AckNumber != 3 {
+		t.Fatalf("Sent segments %v, expected cumulative ACK", segments)
+	}
+
+	if conn.rxUnacked != 0 || conn.cumulativeAckTimer != nil {
+		t.Fatalf("Pending ACK not cleared after cumulative ACK")
+	}
+}
+
+func TestCumulativeAckTimeout(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.CumulativeAckTimeout = 10
+	conn.rxLastInSeq = 0
+
+	conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte{1}})
+
+	var segments []*segment
+	for start := time.Now(); len(segments) == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("ACK not sent after cumulative ACK timeout")
+		}
+		segments = transport.take()
+	}
+
+	if len(segments) != 1 || !segments[0].ACK || segments[0].AckNumber != 1 {
+		t.Fatalf("Sent segments %v, expected ACK", segments)
+	}
+}
+
+func TestPiggybackedAck(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.rxLastInSeq = 0
+
+	conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte{1}})
+	conn.Write([]byte{2})
+
+	segments := transport.take()
+	if len(segments) != 1 || !segments[0].ACK || segments[0].AckNumber != 1 || len(segments[0].Data) != 1 {
+		t.Fatalf("Sent segments %v, expected data with piggybacked ACK", segments)
+	}
+
+	if conn.rxUnacked != 0 || conn.cumulativeAckTimer != nil {
+		t.Fatalf("Pending ACK not cleared by piggybacked ACK")
+	}
+
+	conn.closed(nil)
+}
+
+func TestEakGeneration(t *testing.T) {
+	senderTransport := &testTransport{}
+	sender := NewConn(senderTransport)
+
+	sender.state = StateOpen
+	sender.config = defaultConfig()
+	sender.txNextSeq = 1
+	sender.txOldestUnacked = 0
+
+	receiverTransport := &testTransport{}
+	receiver := NewConn(receiverTransport)
+
+	receiver.state = StateOpen
+	receiver.config = defaultConfig()
+	receiver.txNextSeq = 1
+	receiver.rxLastInSeq = 0
+
+	for i := 1; i <= 5; i++ {
+		sender.Write([]byte{byte(i)})
+	}
+
+	// Lose segments 2 and 4
+	for _, segment := range senderTransport.take() {
+		if segment.SeqNumber != 2 && segment.SeqNumber != 4 {
+			receiver.Receive(marshalSegment(segment, t))
+		}
+	}
+
+	validateRxBuffer(receiver, []uint16{3, 5}, t)
+
+	acks := receiverTransport.take()
+	if len(acks) != 2 {
+		t.Fatalf("Receiver sent %v, expected an EAK for each out of sequence segment", acks)
+	}
+
+	for i, eakNumbers := range [][]uint16{{3}, {3, 5}} {
+		if !acks[i].EAK || acks[i].AckNumber != 1 || !reflect.DeepEqual(acks[i].VarHeader.(*eakVarHeader).EakNumbers, eakNumbers) {
+			t.Fatalf("Receiver sent %v, expected EAK for %v", acks[i], eakNumbers)
+		}
+	}
+
+	for _, ack := range acks {
+		if err := sender.Receive(marshalSegment(ack, t)); err != nil {
+			t.Fatalf("Sender rejected EAK %v: %v", ack, err)
+		}
+	}
+
+	validateTxBuffer(sender, []uint16{2, 4}, t)
+	sender.closed(nil)
+	receiver.closed(nil)
+}
+
+func TestMaxOutOfSeq(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.MaxOutOfSeq = 2
+	conn.rxLastInSeq = 0
+
+	for _, seq := range []uint16{5, 3, 4} {
+		conn.receiveSegment(&segment{SeqNumber: seq, Data: []byte{0}})
+	}
+
+	validateRxBuffer(conn, []uint16{3, 5}, t)
+}
@@ -0,0 +1,99 @@
+package psst
+
+// AutoReset records a resynchronisation of the connection with its peer
+// after an unrecoverable failure, and the data it may have lost
+type AutoReset struct {
+	// Consecutive auto resets including this one, at most MaxAutoReset
+	Count uint8
+	// Cause of the auto reset, ErrRetransmissionLimit when initiated
+	// locally or ErrConnectionReset when initiated by the peer
+	Err error
+	// Data written but not acknowledged by the peer, in the order written.
+	// It may or may not have been delivered and is not retransmitted.
+	Unacked [][]byte
+	// Out of sequence segments received from the peer and discarded, the
+	// peer reports them among its own unacknowledged data
+	Discarded int
+}
+
+// canAutoReset reports whether the connection may be resynchronised rather
+// than failed
+func (self *conn) canAutoReset() bool {
+	return self.config != nil && self.autoResets < self.config.MaxAutoReset
+}
+
+// autoReset discards the transmit and receive buffers and starts a new
+// sequence, to be resynchronised with the peer by a SYN exchange. The
+// negotiated config is kept.
+func (self *conn) autoReset(err error) {
+	self.autoResets++
+	self.stats.AutoResets++
+
+	reset := AutoReset{
+		Count:     self.autoResets,
+		Err:       err,
+		Discarded: self.rxBuffer.Len(),
+	}
+
+	for element := self.txBuffer.Front(); element != nil; element = element.Next() {
+		if entry := element.Value.(*txBufferEntry); !entry.nul && !entry.tcs {
+			reset.Unacked = append(reset.Unacked, entry.Data)
+		}
+	}
+
+	self.txBuffer.Init()
+	self.rxBuffer.Init()
+	self.rxUnacked = 0
+
+	initialSeqNumber := self.resyncSeqNumber()
+	self.txNextSeq = initialSeqNumber + 1
+	self.txOldestUnacked = initialSeqNumber
+	self.txSequenceStart = initialSeqNumber
+	self.synTxCount = 0
+	self.txWindowAdvertised = false
+	self.probes = 0
+	self.tailProbed = false
+	self.resetCongestion()
+
+	self.stopTimers()
+	self.notify(func(handler Handler) { handler.OnAutoReset(reset) })
+}
+
+// resyncSeqNumber picks the initial sequence number of the sequence after an
+// auto reset, clear of the peer's view of the current sequence and repeating
+// neither initial sequence number before it, so that the peer can tell the
+// SYN from a delayed one. With windows too large to keep clear the last pick
+// is used.
+func (self *conn) resyncSeqNumber() uint16 {
+	window := max(self.config.MaxOutstandingSegmentsSelf, self.config.MaxOutstandingSegmentsPeer)
+	for i := 0; ; i++ {
+		initialSeqNumber := self.initialSeqNumber()
+		if initialSeqNumber == self.txInitialSeq || initialSeqNumber == self.txSequenceStart {
+			continue
+		}
+
+		if i >= maxInitialSeqPicks || !near(initialSeqNumber, self.txNextSeq, 4*window) {
+			return initialSeqNumber
+		}
+	}
+}
+
+// resyncSyn reports whether a SYN received while open is from the peer auto
+// resetting the connection. Delayed or duplicate SYNs of the handshake or of
+// an earlier auto reset repeat an initial sequence number already seen, and
+// a new sequence starts clear of the current one.
+func (self *conn) resyncSyn(segment *segment) bool {
+	if !segment.SYN || segment.ACK || segment.EAK || segment.NUL || segment.TCS || !self.canAutoReset() {
+		return false
+	}
+
+	if _, ok := segment.VarHeader.(*synVarHeader); !ok {
+		return false
+	}
+
+	if segment.SeqNumber == self.rxInitialSeq || segment.SeqNumber == self.rxSequenceStart {
+		return false
+	}
+
+	return !near(segment.SeqNumber, self.rxLastInSeq, 2*self.config.MaxOutstandingSegmentsSelf)
+}
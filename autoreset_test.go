@@ -0,0 +1,165 @@
+package psst
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAutoReset(t *testing.T) {
+	config := DefaultConfig()
+	config.RetransmissionTimeout = 10 * time.Second
+	config.CumulativeAckTimeout = 5 * time.Second
+	config.MaxRetransmissions = 1
+	config.MaxAutoReset = 1
+
+	listener := NewConn(&testTransport{})
+	listener.Listen(config)
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(config)
+
+	exchange(listener, dialer, t)
+
+	listenerHandler := &recordingHandler{}
+	listener.SetHandler(listenerHandler)
+	dialerHandler := &recordingHandler{}
+	dialer.SetHandler(dialerHandler)
+
+	// Lose the data and its retransmission
+	expire := func() {
+		dialer.mutex.Lock()
+		for element := dialer.txBuffer.Front(); element != nil; element = element.Next() {
+			element.Value.(*txBufferEntry).sentAt = time.Time{}
+		}
+		dialer.retransmit()
+		dialer.unlock()
+	}
+
+	dialer.Write([]byte{0xa})
+	dialer.Write([]byte{0xb})
+	dialer.transport.(*testTransport).take()
+
+	expire()
+	dialer.transport.(*testTransport).take()
+
+	txNextSeq := dialer.txNextSeq
+	expire()
+
+	segments := dialer.transport.(*testTransport).take()
+	if len(segments) != 1 || !segments[0].SYN || segments[0].ACK || dialer.state != StateSynSent || dialer.txBuffer.Len() != 0 {
+		t.Fatalf("Dialer sent %v in %v after retransmission limit, expected SYN", segments, dialer.state)
+	}
+	dialer.transport.(*testTransport).segments = segments
+
+	exchange(listener, dialer, t)
+
+	if listener.state != StateOpen || dialer.state != StateOpen || dialer.txNextSeq == txNextSeq {
+		t.Fatalf("Connection in %v and %v after auto reset", listener.state, dialer.state)
+	}
+
+	validateEvents(dialerHandler, []string{
+		"auto reset 1 Retransmission limit exceeded [0a 0b] 0",
+		"state StateOpen StateSynSent",
+		"state StateSynSent StateOpen",
+		"open",
+	}, t)
+
+	if err := dialer.Write([]byte{0xc}); err != nil {
+		t.Fatalf("Write failed with %v after auto reset", err)
+	}
+	exchange(listener, dialer, t)
+
+	validateEvents(listenerHandler, []string{
+		"auto reset 1 Connection reset by peer [] 0",
+		"state StateOpen StateSynReceived",
+		"state StateSynReceived StateOpen",
+		"open",
+		"data 0c",
+	}, t)
+
+	// Consecutive auto resets are limited to MaxAutoReset
+	dialer.transport.(*testTransport).take()
+	expire()
+	expire()
+
+	segments = dialer.transport.(*testTransport).take()
+	if len(segments) != 2 || !segments[1].RST || !bytes.Equal(segments[1].Data, []byte(ErrRetransmissionLimit.Error())) {
+		t.Fatalf("Dialer sent %v after auto reset limit, expected RST", segments)
+	}
+
+	if dialer.state != StateClosed || dialer.err != ErrRetransmissionLimit || dialer.Stats().AutoResets != 1 {
+		t.Fatalf("Connection in %v with error %v after auto reset limit", dialer.state, dialer.err)
+	}
+
+	listener.mutex.Lock()
+	listener.closed(nil)
+	listener.unlock()
+}
+
+func TestAutoResetProgress(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.MaxAutoReset = 1
+	conn.txNextSeq = 3
+	conn.txOldestUnacked = 0
+	conn.autoResets = 1
+
+	enqueueTxSegments(conn, 2)
+
+	if action, _ := conn.validateSegment(&segment{SYN: true, SeqNumber: 0x8000, VarHeader: &synVarHeader{}}); action == ActionContinue {
+		t.Fatalf("SYN accepted in StateOpen after auto reset limit")
+	}
+
+	conn.handleSegment(&segment{ACK: true, SeqNumber: 1, AckNumber: 1})
+
+	if conn.autoResets != 0 {
+		t.Fatalf("Auto reset count %d not cleared by acknowledged data", conn.autoResets)
+	}
+
+	if action, err := conn.validateSegment(&segment{SYN: true, SeqNumber: 0x8000, VarHeader: &synVarHeader{}}); action != ActionContinue {
+		t.Fatalf("SYN rejected with %v in StateOpen, expected auto reset", err)
+	}
+
+	conn.closed(nil)
+}
+
+func TestStaleSyn(t *testing.T) {
+	config := transferConfig()
+	config.MaxAutoReset = 3
+
+	listener := NewConn(&testTransport{})
+	listener.Listen(config)
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(config)
+
+	syn := dialer.transport.(*testTransport).segments[0]
+	exchange(listener, dialer, t)
+
+	dialer.Write([]byte{0xa})
+	listener.Write([]byte{0xb})
+	exchange(listener, dialer, t)
+
+	// Delayed copies of the handshake SYN, and SYNs within the current
+	// sequence, are answered with an ACK rather than auto resetting
+	for _, stale := range []*segment{syn, {SYN: true, SeqNumber: listener.rxLastInSeq - 1, VarHeader: config.synHeader()}} {
+		if err := listener.Receive(marshalSegment(stale, t)); !errors.Is(err, ErrUnexpectedSeqNumber) {
+			t.Fatalf("Stale SYN %v failed with %v, expected unexpected sequence number", stale, err)
+		}
+
+		segments := listener.transport.(*testTransport).take()
+		if len(segments) != 1 || segments[0].SYN || !segments[0].ACK || listener.state != StateOpen {
+			t.Fatalf("Listener sent %v in %v after stale SYN, expected ACK", segments, listener.state)
+		}
+	}
+
+	if stats := listener.Stats(); stats.AutoResets != 0 || stats.TxBufferDepth != 1 {
+		t.Fatalf("Stats %+v after stale SYNs, expected no auto reset", stats)
+	}
+
+	closePair(listener, dialer)
+}
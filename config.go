@@ -0,0 +1,209 @@
+package psst
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config holds the connection parameters a conn offers to its peer in the
+// SYN segment. Use DefaultConfig as a starting point.
+type Config struct {
+	// Largest data payload of a single segment in octets. Default 4096.
+	MaxSegmentSize uint16
+	// Number of segments the peer may send before waiting for an ACK, this
+	// is the receive window of the conn. Default 32.
+	MaxOutstandingSegments uint16
+	// Initial time after which an unacknowledged segment is retransmitted,
+	// adapted to the measured round trip time once the connection is open
+	// within CumulativeAckTimeout and NulTimeout. Default 2s.
+	RetransmissionTimeout time.Duration
+	// Time a received segment may go unacknowledged, waiting for other
+	// segments to acknowledge with it. Default 300ms.
+	CumulativeAckTimeout time.Duration
+	// Idle time after which a NUL segment is sent to check the peer is still
+	// alive. Default 30s.
+	NulTimeout time.Duration
+	// Number of NulTimeouts without any segment from the peer after which it
+	// is considered dead and the connection is closed, 0 disables the check.
+	// Not negotiated. Default 3.
+	DeadPeerMultiple uint8
+	// Time after a connection closes during which its identifier and
+	// sequence numbers are remembered, answering delayed segments from it
+	// with RST and keeping them and its identifier out of new connections to
+	// the same peer. The peer is told apart by a PeerTransport, otherwise
+	// only the same conn is covered. 0 disables the quiet period. Not
+	// negotiated. Default 1m.
+	QuietPeriod time.Duration
+	// Number of times a segment is retransmitted before the connection is
+	// considered broken, 0 retransmits forever. Default 4.
+	MaxRetransmissions uint8
+	// Number of received segments that may go unacknowledged before an ACK
+	// is sent, 0 acknowledges every segment immediately. Default 8.
+	MaxCumulativeAck uint8
+	// Number of out of sequence segments the conn buffers while waiting for
+	// a missing segment, further ones are dropped. Buffered segments are
+	// reported to the sender with EAKs. Default 8.
+	MaxOutOfSeq uint8
+	// Number of segments sent after an outstanding one that the peer must
+	// acknowledge with EAKs before it is retransmitted, without waiting for
+	// the retransmission timeout. It should not exceed the peer's
+	// MaxOutOfSeq. 0 disables fast retransmit. Not negotiated. Default 3.
+	FastRetransmitThreshold uint8
+	// Resends the newest outstanding segment once its ACK is overdue, so
+	// that losses at the end of a burst, which draw no EAKs, are repaired
+	// ahead of the retransmission timeout. Not negotiated. Default on.
+	TailLossProbe bool
+	// Number of consecutive auto resets, resynchronising sequence numbers
+	// with the peer and discarding unacknowledged data, before a broken
+	// connection is closed. 0 closes it at once. Default 3.
+	MaxAutoReset uint8
+	// Policy for settling timeouts and limits that differ from the peer's.
+	// Default NegotiateAccept.
+	Negotiation Negotiation
+	// Key shared with the peer that authenticates transfers of the
+	// connection to a new transport, such as the PSS symmetric key. Transfers
+	// are refused without one. Not negotiated. Default none.
+	TransferKey []byte
+	// Creates the congestion controller of each connection, which limits
+	// the segments in flight below the peer's window. Not negotiated, nor
+	// kept by Suspend. Default NewReno.
+	CongestionControl func() CongestionController
+	// Holds back small stream writes while data is outstanding, to send them
+	// together, as in Nagle's algorithm. Not negotiated. Default off.
+	CoalesceWrites bool
+	// Interval between searches for the largest segment the route to the
+	// peer delivers, which then caps the data of Stream's segments below
+	// MaxSegmentSize. Segments of up to 1024 octets are assumed to be
+	// delivered by any route. 0 disables discovery. Not negotiated. Default
+	// 0.
+	PathProbeInterval time.Duration
+	// Cap on the data sent in octets per second, on top of pacing to the
+	// congestion window, 0 for no cap. Not negotiated. Default none.
+	MaxSendRate int
+}
+
+// Timeouts are carried in the SYN header as 16-bit millisecond values
+const (
+	minTimeout = time.Millisecond
+	maxTimeout = 0xFFFF * time.Millisecond
+)
+
+// Sequence numbers are compared as signed 16-bit differences, so twice the
+// receive window must stay below half the sequence space
+const maxOutstandingSegments = 0x3FFF
+
+const synVersion = 1
+
+// DefaultConfig returns a new Config with the default parameters
+func DefaultConfig() *Config {
+	return &Config{
+		MaxSegmentSize:          4096,
+		MaxOutstandingSegments:  32,
+		RetransmissionTimeout:   2 * time.Second,
+		CumulativeAckTimeout:    300 * time.Millisecond,
+		NulTimeout:              30 * time.Second,
+		DeadPeerMultiple:        3,
+		QuietPeriod:             time.Minute,
+		MaxRetransmissions:      4,
+		MaxCumulativeAck:        8,
+		MaxOutOfSeq:             8,
+		FastRetransmitThreshold: 3,
+		TailLossProbe:           true,
+		MaxAutoReset:            3,
+		CongestionControl:       NewReno,
+	}
+}
+
+// Validate checks that all parameters are in range and can be represented
+// in the SYN header
+func (self *Config) Validate() error {
+	if self.MaxSegmentSize == 0 {
+		return fmt.Errorf("MaxSegmentSize must be non-zero")
+	}
+
+	if self.MaxOutstandingSegments == 0 || self.MaxOutstandingSegments > maxOutstandingSegments {
+		return fmt.Errorf("MaxOutstandingSegments must be between 1 and %d", maxOutstandingSegments)
+	}
+
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"RetransmissionTimeout", self.RetransmissionTimeout},
+		{"CumulativeAckTimeout", self.CumulativeAckTimeout},
+		{"NulTimeout", self.NulTimeout},
+	}
+
+	for _, timeout := range timeouts {
+		if timeout.value < minTimeout || timeout.value > maxTimeout {
+			return fmt.Errorf("%s must be between %v and %v", timeout.name, minTimeout, maxTimeout)
+		}
+	}
+
+	if self.QuietPeriod < 0 {
+		return fmt.Errorf("QuietPeriod must not be negative")
+	}
+
+	if self.PathProbeInterval < 0 {
+		return fmt.Errorf("PathProbeInterval must not be negative")
+	}
+
+	if self.MaxSendRate < 0 {
+		return fmt.Errorf("MaxSendRate must not be negative")
+	}
+
+	if self.CumulativeAckTimeout >= self.RetransmissionTimeout {
+		return fmt.Errorf("CumulativeAckTimeout must be less than RetransmissionTimeout")
+	}
+
+	if self.NulTimeout <= self.RetransmissionTimeout {
+		return fmt.Errorf("NulTimeout must be greater than RetransmissionTimeout")
+	}
+
+	if uint16(self.MaxOutOfSeq) > self.MaxOutstandingSegments {
+		return fmt.Errorf("MaxOutOfSeq must not exceed MaxOutstandingSegments")
+	}
+
+	if self.Negotiation > NegotiateReject {
+		return fmt.Errorf("Unknown Negotiation policy %d", self.Negotiation)
+	}
+
+	return nil
+}
+
+func (self *Config) synHeader() *synVarHeader {
+	return &synVarHeader{
+		Version:                synVersion,
+		MaxSegmentSize:         self.MaxSegmentSize,
+		MaxOutstandingSegments: self.MaxOutstandingSegments,
+		RetransmissionTimeout:  durationToMillis(self.RetransmissionTimeout),
+		CumulativeAckTimeout:   durationToMillis(self.CumulativeAckTimeout),
+		NulTimeout:             durationToMillis(self.NulTimeout),
+		MaxRetransmissions:     self.MaxRetransmissions,
+		MaxCumulativeAck:       self.MaxCumulativeAck,
+		MaxOutOfSeq:            self.MaxOutOfSeq,
+		MaxAutoReset:           self.MaxAutoReset,
+	}
+}
+
+func (self *synVarHeader) config() *Config {
+	return &Config{
+		MaxSegmentSize:         self.MaxSegmentSize,
+		MaxOutstandingSegments: self.MaxOutstandingSegments,
+		RetransmissionTimeout:  millisToDuration(self.RetransmissionTimeout),
+		CumulativeAckTimeout:   millisToDuration(self.CumulativeAckTimeout),
+		NulTimeout:             millisToDuration(self.NulTimeout),
+		MaxRetransmissions:     self.MaxRetransmissions,
+		MaxCumulativeAck:       self.MaxCumulativeAck,
+		MaxOutOfSeq:            self.MaxOutOfSeq,
+		MaxAutoReset:           self.MaxAutoReset,
+	}
+}
+
+func durationToMillis(duration time.Duration) uint16 {
+	return uint16(duration / time.Millisecond)
+}
+
+func millisToDuration(millis uint16) time.Duration {
+	return time.Duration(millis) * time.Millisecond
+}
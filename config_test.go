@@ -0,0 +1,101 @@
+package psst
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDefaultConfigValidation(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("Default config failed validation: %v", err)
+	}
+}
+
+func TestInvalidConfigValidation(t *testing.T) {
+	input := []func(*Config){
+		func(config *Config) { config.MaxSegmentSize = 0 },
+		func(config *Config) { config.MaxOutstandingSegments = 0 },
+		func(config *Config) { config.MaxOutstandingSegments = 0x4000 },
+		func(config *Config) { config.RetransmissionTimeout = 0 },
+		func(config *Config) { config.RetransmissionTimeout = 0x10000 * time.Millisecond },
+		func(config *Config) { config.CumulativeAckTimeout = time.Microsecond },
+		func(config *Config) { config.NulTimeout = 70 * time.Second },
+		func(config *Config) { config.CumulativeAckTimeout = config.RetransmissionTimeout },
+		func(config *Config) { config.NulTimeout = config.RetransmissionTimeout },
+		func(config *Config) { config.MaxOutOfSeq = 33 },
+	}
+
+	for i, modify := range input {
+		config := DefaultConfig()
+		modify(config)
+
+		if err := config.Validate(); err == nil {
+			t.Fatalf("Invalid config %d passed validation: %+v", i, config)
+		}
+	}
+}
+
+func TestConfigSynHeaderMapping(t *testing.T) {
+	config := DefaultConfig()
+	synHeader := config.synHeader()
+
+	expected := &synVarHeader{
+		Version:                1,
+		MaxSegmentSize:         4096,
+		MaxOutstandingSegments: 32,
+		RetransmissionTimeout:  2000,
+		CumulativeAckTimeout:   300,
+		NulTimeout:             30000,
+		MaxRetransmissions:     4,
+		MaxCumulativeAck:       8,
+		MaxOutOfSeq:            8,
+		MaxAutoReset:           3,
+	}
+
+	if !reflect.DeepEqual(synHeader, expected) {
+		t.Fatalf("SYN header %+v doesn't match expected %+v", synHeader, expected)
+	}
+
+	// Local settings are not carried in the SYN header
+	config.DeadPeerMultiple = 0
+	config.QuietPeriod = 0
+	config.FastRetransmitThreshold = 0
+	config.TailLossProbe = false
+	config.CongestionControl = nil
+
+	if mapped := synHeader.config(); !reflect.DeepEqual(mapped, config) {
+		t.Fatalf("Config %+v mapped from SYN header doesn't match expected %+v", mapped, config)
+	}
+}
+
+func TestListenAndDialConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxSegmentSize = 0
+
+	conn := NewConn(&testTransport{})
+	if err := conn.Listen(config); err == nil {
+		t.Fatalf("Listen accepted invalid config")
+	}
+
+	if err := conn.Listen(nil); err != nil || conn.state != StateListen {
+		t.Fatalf("Listen failed with default config: %v", err)
+	}
+
+	if err := conn.Dial(nil); err == nil {
+		t.Fatalf("Dial accepted conn already listening")
+	}
+
+	conn = NewConn(&testTransport{})
+	config = DefaultConfig()
+	config.MaxOutstandingSegments = 64
+
+	if err := conn.Dial(config); err != nil || conn.state != StateSynSent {
+		t.Fatalf("Dial failed with valid config: %v", err)
+	}
+
+	config.MaxOutstandingSegments = 0
+	if conn.localConfig.MaxOutstandingSegments != 64 {
+		t.Fatalf("Dial didn't copy config")
+	}
+}
@@ -0,0 +1,140 @@
+package psst
+
+import (
+	"time"
+)
+
+// CongestionController limits the number of segments in flight to what the
+// path to the peer can carry, so that connections share the PSS forwarding
+// path with other traffic. Writes block once the congestion window or the
+// peer's window is full, whichever is smaller.
+//
+// Methods are called with the conn's internal lock held and must not call
+// back into the conn.
+type CongestionController interface {
+	// OnSend is called for every segment transmitted or retransmitted, with
+	// the number of segments in flight including it
+	OnSend(inFlight int)
+	// OnAck is called with the number of segments newly acknowledged and
+	// the latest round trip time sample, zero until one has been measured
+	OnAck(acked int, rtt time.Duration)
+	// OnLoss is called when EAKs show that segments sent before the ones
+	// received out of sequence have been lost
+	OnLoss(inFlight int)
+	// OnTimeout is called when outstanding segments are retransmitted after
+	// the retransmission timeout
+	OnTimeout(inFlight int)
+	// Window returns the number of segments that may be in flight
+	Window() int
+}
+
+const (
+	// Congestion window of a new connection in segments, as in RFC 6928
+	initialWindow = 10
+	// Smallest slow start threshold after a loss, in segments
+	minThreshold = 2
+)
+
+// newReno is an AIMD controller in the style of TCP NewReno, counting the
+// window in segments. The window grows by a segment per segment acknowledged
+// in slow start and by a segment per window acknowledged in congestion
+// avoidance. It is halved on loss, at most once per window of data, and
+// restarts from a single segment on timeout.
+type newReno struct {
+	window    int
+	threshold int
+	// Segments acknowledged towards the next increase in congestion
+	// avoidance
+	acked int
+	// Segments in flight when loss was detected, to be acknowledged before
+	// a further loss reduces the window again
+	recovery int
+}
+
+// NewReno returns the default congestion controller
+func NewReno() CongestionController {
+	return &newReno{
+		window:    initialWindow,
+		threshold: maxOutstandingSegments,
+	}
+}
+
+func (self *newReno) OnSend(inFlight int) {
+}
+
+func (self *newReno) OnAck(acked int, rtt time.Duration) {
+	if self.recovery > 0 {
+		self.recovery = max(self.recovery-acked, 0)
+		return
+	}
+
+	if self.window < self.threshold {
+		self.window = min(self.window+acked, self.threshold)
+		return
+	}
+
+	self.acked += acked
+	if self.acked >= self.window && self.window < maxOutstandingSegments {
+		self.acked -= self.window
+		self.window++
+	}
+}
+
+func (self *newReno) OnLoss(inFlight int) {
+	if self.recovery > 0 {
+		return
+	}
+
+	self.threshold = max(inFlight/2, minThreshold)
+	self.window = self.threshold
+	self.recovery = max(inFlight, 1)
+	self.acked = 0
+}
+
+func (self *newReno) OnTimeout(inFlight int) {
+	self.threshold = max(inFlight/2, minThreshold)
+	self.window = 1
+	self.recovery = 0
+	self.acked = 0
+}
+
+func (self *newReno) Window() int {
+	return self.window
+}
+
+// resetCongestion starts a new congestion controller, for a new connection
+// or a new path to the peer
+func (self *conn) resetCongestion() {
+	if self.localConfig != nil && self.localConfig.CongestionControl != nil {
+		self.congestion = self.localConfig.CongestionControl()
+		return
+	}
+
+	self.congestion = NewReno()
+}
+
+// congestionWindow is the number of segments that may be in flight, never
+// less than one
+func (self *conn) congestionWindow() int {
+	return max(self.congestion.Window(), 1)
+}
+
+// detectLoss reports lost segments to the congestion controller when EAKs
+// acknowledge segments sent after ones still outstanding
+func (self *conn) detectLoss(eakNumbers []uint16) {
+	front := self.txBuffer.Front()
+	if front == nil || len(eakNumbers) == 0 {
+		return
+	}
+
+	highest := eakNumbers[0]
+	for _, eak := range eakNumbers[1:] {
+		if diff := int16(eak - highest); diff > 0 {
+			highest = eak
+		}
+	}
+
+	if diff := int16(front.Value.(*txBufferEntry).SeqNumber - highest); diff < 0 {
+		self.congestion.OnLoss(self.txBuffer.Len())
+	}
+}
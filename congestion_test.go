@@ -0,0 +1,101 @@
+package psst
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type recordingController struct {
+	window int
+	events []string
+}
+
+func (self *recordingController) OnSend(inFlight int) {
+	self.events = append(self.events, fmt.Sprintf("send %d", inFlight))
+}
+
+func (self *recordingController) OnAck(acked int, rtt time.Duration) {
+	self.events = append(self.events, fmt.Sprintf("ack %d", acked))
+}
+
+func (self *recordingController) OnLoss(inFlight int) {
+	self.events = append(self.events, fmt.Sprintf("loss %d", inFlight))
+}
+
+func (self *recordingController) OnTimeout(inFlight int) {
+	self.events = append(self.events, fmt.Sprintf("timeout %d", inFlight))
+}
+
+func (self *recordingController) Window() int {
+	return self.window
+}
+
+func TestNewReno(t *testing.T) {
+	controller := NewReno()
+
+	// Slow start doubles the window every round trip
+	controller.OnAck(initialWindow, time.Millisecond)
+	if window := controller.Window(); window != 2*initialWindow {
+		t.Fatalf("Window %d in slow start, expected %d", window, 2*initialWindow)
+	}
+
+	// Loss halves the window once per window of data
+	controller.OnLoss(20)
+	controller.OnLoss(20)
+	if window := controller.Window(); window != 10 {
+		t.Fatalf("Window %d after loss, expected 10", window)
+	}
+
+	// The window stays put until the segments in flight at the loss are
+	// acknowledged, then grows by a segment per window
+	controller.OnAck(20, time.Millisecond)
+	controller.OnAck(9, time.Millisecond)
+	if window := controller.Window(); window != 10 {
+		t.Fatalf("Window %d in congestion avoidance, expected 10", window)
+	}
+
+	controller.OnAck(1, time.Millisecond)
+	if window := controller.Window(); window != 11 {
+		t.Fatalf("Window %d after a window acknowledged, expected 11", window)
+	}
+
+	// Timeout restarts slow start from a single segment up to half the
+	// segments in flight
+	controller.OnTimeout(11)
+	controller.OnAck(1, time.Millisecond)
+	controller.OnAck(8, time.Millisecond)
+	if window := controller.Window(); window != 5 {
+		t.Fatalf("Window %d in slow start after timeout, expected 5", window)
+	}
+}
+
+func TestCongestionWindow(t *testing.T) {
+	conn := windowConn()
+	conn.config.MaxOutstandingSegmentsPeer = 10
+	controller := &recordingController{window: 2}
+	conn.congestion = controller
+	conn.SetNonBlocking(true)
+
+	for i := 0; i < 3; i++ {
+		conn.Write([]byte{byte(i)})
+	}
+
+	validateTxBuffer(conn, []uint16{1, 2}, t)
+
+	// The EAK for segment 2 shows segment 1 has been lost
+	conn.receiveSegment(&segment{ACK: true, EAK: true, SeqNumber: 1, AckNumber: 0, VarHeader: &eakVarHeader{EakNumbers: []uint16{2}}})
+
+	conn.txBuffer.Front().Value.(*txBufferEntry).sentAt = time.Time{}
+	conn.retransmit()
+
+	expected := []string{"send 1", "send 2", "ack 1", "loss 1", "timeout 1", "send 1"}
+	if !reflect.DeepEqual(controller.events, expected) {
+		t.Fatalf("Controller events %v don't match expected %v", controller.events, expected)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
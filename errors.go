@@ -0,0 +1,72 @@
+package psst
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Segment decoding error
+var ErrMalformedSegment = errors.New("Malformed segment")
+
+// Segment validation errors, wrapped in a ProtocolError
+var (
+	ErrUnexpectedSegment   = errors.New("Unexpected segment")
+	ErrInvalidFlags        = errors.New("Invalid segment flags")
+	ErrMissingSynHeader    = errors.New("SYN segment missing header")
+	ErrMissingEakHeader    = errors.New("EAK segment missing header")
+	ErrInitialAckMismatch  = errors.New("Initial ACK does not match initial sequence number")
+	ErrInitialAckMissing   = errors.New("Need ACK for initial SYN before proceeding")
+	ErrUnexpectedSeqNumber = errors.New("Unexpected sequence number")
+	ErrNulWithData         = errors.New("NUL segment must not contain data payload")
+	ErrAckUnsent           = errors.New("ACK received for unsent sequence number")
+	ErrEakBelowAck         = errors.New("EAK number smaller than segment ACK number")
+	ErrEakUnsent           = errors.New("EAK received for unsent sequence number")
+	ErrInvalidTransfer     = errors.New("TCS segment failed authentication")
+	ErrStaleSegment        = errors.New("Segment from a closed connection")
+	ErrOversizeSegment     = errors.New("Segment data exceeds maximum segment size")
+)
+
+// Connection errors
+var (
+	ErrConnectionInUse     = errors.New("Connection already in use")
+	ErrNotOpen             = errors.New("Connection not open")
+	ErrSegmentTooLarge     = errors.New("Data exceeds maximum segment size")
+	ErrConnectionReset     = errors.New("Connection reset by peer")
+	ErrIncompatibleConfig  = errors.New("Incompatible connection config")
+	ErrRetransmissionLimit = errors.New("Retransmission limit exceeded")
+	ErrPeerTimeout         = errors.New("Peer not responding")
+	ErrNoTransferKey       = errors.New("No transfer key configured")
+	ErrTransferred         = errors.New("Connection transferred")
+	ErrAddressTooLong      = errors.New("Transport address too long for a TCS segment")
+	ErrWouldBlock          = errors.New("Peer window full")
+)
+
+// ProtocolError describes an incoming segment that failed validation and
+// the action taken in response
+type ProtocolError struct {
+	// One of the segment validation errors
+	Err error
+	// Response to the segment
+	Action Action
+	// Connection state the segment was received in
+	State State
+	// Summary of the segment header
+	Segment string
+}
+
+func (self *ProtocolError) Error() string {
+	return fmt.Sprintf("%v: %v in %v, %v", self.Err, self.Segment, self.State, self.Action)
+}
+
+func (self *ProtocolError) Unwrap() error {
+	return self.Err
+}
+
+func (self *conn) reject(action Action, err error, segment *segment) (Action, error) {
+	return action, &ProtocolError{
+		Err:     err,
+		Action:  action,
+		State:   self.state,
+		Segment: segment.String(),
+	}
+}
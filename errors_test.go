@@ -0,0 +1,72 @@
+package psst
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidationErrors(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.txNextSeq = 0x1234
+	conn.txOldestUnacked = conn.txNextSeq - 10
+
+	input := []struct {
+		*segment
+		err error
+	}{
+		{&segment{SeqNumber: conn.rxLastInSeq}, ErrUnexpectedSeqNumber},
+		{&segment{SYN: true, SeqNumber: conn.rxLastInSeq + 1}, ErrInvalidFlags},
+		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, ErrNulWithData},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq}, ErrAckUnsent},
+		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked}, ErrMissingEakHeader},
+		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked + 5, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 2}}}, ErrEakBelowAck},
+		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txNextSeq}}}, ErrEakUnsent},
+	}
+
+	for _, i := range input {
+		action, err := conn.validateSegment(i.segment)
+
+		if !errors.Is(err, i.err) {
+			t.Fatalf("Segment validation error %v for segment %v doesn't match expected %v", err, i.segment, i.err)
+		}
+
+		var protocolError *ProtocolError
+		if !errors.As(err, &protocolError) {
+			t.Fatalf("Segment validation error %v is not a ProtocolError", err)
+		}
+
+		if protocolError.Action != action || protocolError.State != StateOpen || protocolError.Segment != i.segment.String() {
+			t.Fatalf("ProtocolError %+v doesn't match action %v, state and segment %v", protocolError, action, i.segment)
+		}
+	}
+}
+
+func TestResetByPeerError(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+
+	conn.handleSegment(&segment{RST: true})
+
+	if conn.state != StateClosed || conn.err != ErrConnectionReset {
+		t.Fatalf("Connection in state %v with error %v after RST", conn.state, conn.err)
+	}
+}
+
+func TestSegmentSummary(t *testing.T) {
+	segment := &segment{
+		SYN:       true,
+		ACK:       true,
+		SeqNumber: 0x1234,
+		AckNumber: 0x5678,
+		Data:      []byte{0, 0, 0},
+	}
+
+	if summary := segment.String(); summary != "[SYN|ACK] seq 4660 ack 22136 len 3" {
+		t.Fatalf("Segment summary %q doesn't match expected", summary)
+	}
+}
@@ -0,0 +1,76 @@
+package psst
+
+// Handler receives connection events as an alternative to blocking reads,
+// for applications that drive connections from their own event loop.
+//
+// Handler methods for a given conn are never called concurrently and are
+// called in the order the events occurred. They run on whichever goroutine
+// caused the event, that is the goroutine delivering an incoming segment or
+// a timer goroutine, after the conn's internal lock has been released.
+//
+// A handler may call back into the conn it is attached to. Events raised by
+// such a call are queued and delivered once the current handler method has
+// returned, rather than recursively. Handlers should return promptly as they
+// hold up the delivery of further events for the conn.
+type Handler interface {
+	// OnOpen is called once the connection is established, and again once
+	// it is reopened after an auto reset
+	OnOpen()
+	// OnData is called with each in-order data payload. The handler owns data.
+	OnData(data []byte)
+	// OnAck is called when a sent segment has been acknowledged by the peer
+	OnAck(seqNumber uint16)
+	// OnWritable is called once a Write refused with ErrWouldBlock can be
+	// retried
+	OnWritable()
+	// OnAutoReset is called when the connection is resynchronised with the
+	// peer, before it is reopened
+	OnAutoReset(reset AutoReset)
+	// OnStateChange is called on every state transition
+	OnStateChange(from, to State)
+	// OnClose is called once the connection is closed, with the cause if any
+	OnClose(err error)
+}
+
+// SetHandler installs the handler for connection events. A nil handler
+// disables event delivery. While a handler is installed data is delivered to
+// OnData instead of being queued for ReadMessage, Messages and Subscribe.
+func (self *conn) SetHandler(handler Handler) {
+	self.mutex.Lock()
+	defer self.unlock()
+	self.handler = handler
+}
+
+// notify queues an event for delivery by unlock. Must be called with the
+// lock held.
+func (self *conn) notify(event func(Handler)) {
+	if self.handler != nil {
+		self.events = append(self.events, event)
+	}
+}
+
+// unlock releases the conn lock and delivers queued events. Only one
+// goroutine delivers events at a time, events queued while it is busy are
+// picked up by it before it returns.
+func (self *conn) unlock() {
+	if self.dispatching {
+		self.mutex.Unlock()
+		return
+	}
+
+	self.dispatching = true
+	for len(self.events) > 0 {
+		events, handler := self.events, self.handler
+		self.events = nil
+
+		self.mutex.Unlock()
+		if handler != nil {
+			for _, event := range events {
+				event(handler)
+			}
+		}
+		self.mutex.Lock()
+	}
+	self.dispatching = false
+	self.mutex.Unlock()
+}
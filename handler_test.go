@@ -0,0 +1,109 @@
+package psst
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type recordingHandler struct {
+	events []string
+	onData func(data []byte)
+}
+
+func (self *recordingHandler) OnOpen() {
+	self.events = append(self.events, "open")
+}
+
+func (self *recordingHandler) OnData(data []byte) {
+	self.events = append(self.events, fmt.Sprintf("data %x", data))
+	if self.onData != nil {
+		self.onData(data)
+	}
+}
+
+func (self *recordingHandler) OnAck(seqNumber uint16) {
+	self.events = append(self.events, fmt.Sprintf("ack %d", seqNumber))
+}
+
+func (self *recordingHandler) OnWritable() {
+	self.events = append(self.events, "writable")
+}
+
+func (self *recordingHandler) OnAutoReset(reset AutoReset) {
+	self.events = append(self.events, fmt.Sprintf("auto reset %d %v %x %d", reset.Count, reset.Err, reset.Unacked, reset.Discarded))
+}
+
+func (self *recordingHandler) OnStateChange(from, to State) {
+	self.events = append(self.events, fmt.Sprintf("state %v %v", from, to))
+}
+
+func (self *recordingHandler) OnClose(err error) {
+	self.events = append(self.events, fmt.Sprintf("close %v", err))
+}
+
+func TestHandlerEvents(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateSynReceived
+	conn.config = defaultConfig()
+	conn.txNextSeq = 3
+	conn.txOldestUnacked = 0
+	conn.rxLastInSeq = 0
+
+	enqueueTxSegments(conn, 2)
+
+	handler := &recordingHandler{}
+	conn.SetHandler(handler)
+
+	inputSegment := &segment{
+		ACK:       true,
+		SeqNumber: 1,
+		AckNumber: 4,
+		Data:      []byte{0xaa},
+	}
+
+	conn.receiveSegment(inputSegment)
+	conn.receiveSegment(&segment{RST: true})
+
+	validateEvents(handler, []string{
+		"state StateSynReceived StateOpen",
+		"open",
+		"ack 3",
+		"ack 4",
+		"data aa",
+		"state StateOpen StateClosed",
+		"close Connection reset by peer",
+	}, t)
+}
+
+func TestHandlerReentry(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.rxLastInSeq = 0
+
+	handler := &recordingHandler{}
+	handler.onData = func(data []byte) {
+		if data[0] == 1 {
+			conn.receiveSegment(&segment{SeqNumber: 2, Data: []byte{2}})
+			handler.events = append(handler.events, "returned")
+		}
+	}
+	conn.SetHandler(handler)
+
+	conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte{1}})
+
+	validateEvents(handler, []string{
+		"data 01",
+		"returned",
+		"data 02",
+	}, t)
+}
+
+func validateEvents(handler *recordingHandler, expected []string, t *testing.T) {
+	if !reflect.DeepEqual(handler.events, expected) {
+		t.Fatalf("Handler events %q don't match expected %q", handler.events, expected)
+	}
+}
@@ -0,0 +1,77 @@
+package psst
+
+import (
+	"time"
+)
+
+// armNulTimer schedules the next keepalive, sent by the client once it has
+// been idle for NulTimeout, or the next check that the peer is still alive
+func (self *conn) armNulTimer() {
+	if self.nulTimer != nil {
+		self.nulTimer.Stop()
+		self.nulTimer = nil
+	}
+
+	if self.state != StateOpen {
+		return
+	}
+
+	var next time.Time
+	if deadline, ok := self.deadPeerDeadline(); ok {
+		next = deadline
+	}
+
+	if self.client {
+		keepalive := self.lastSent.Add(millisToDuration(self.config.NulTimeout))
+		if next.IsZero() || keepalive.Before(next) {
+			next = keepalive
+		}
+	}
+
+	if next.IsZero() {
+		return
+	}
+
+	self.nulTimer = time.AfterFunc(time.Until(next), self.nulTimerExpired)
+}
+
+func (self *conn) nulTimerExpired() {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	self.nulTimer = nil
+	self.keepalive()
+}
+
+// keepalive closes the connection once the peer has been silent for too long
+// and sends a NUL once the client has been idle for NulTimeout
+func (self *conn) keepalive() {
+	if self.state != StateOpen {
+		return
+	}
+
+	now := time.Now()
+	if deadline, ok := self.deadPeerDeadline(); ok && !now.Before(deadline) {
+		self.fire(eventReset, nil, ErrPeerTimeout)
+		return
+	}
+
+	// A full window is kept busy by retransmissions instead, NULs are
+	// accepted beyond a closed receive window
+	if self.client && (self.writable() || self.txBuffer.Len() == 0) && now.Sub(self.lastSent) >= millisToDuration(self.config.NulTimeout) {
+		self.transmit(&txBufferEntry{nul: true})
+	}
+
+	self.armNulTimer()
+}
+
+// deadPeerDeadline is the time the peer is considered dead unless a segment
+// arrives from it before then
+func (self *conn) deadPeerDeadline() (time.Time, bool) {
+	if self.localConfig == nil || self.localConfig.DeadPeerMultiple == 0 {
+		return time.Time{}, false
+	}
+
+	timeout := time.Duration(self.localConfig.DeadPeerMultiple) * millisToDuration(self.config.NulTimeout)
+	return self.lastReceived.Add(timeout), true
+}
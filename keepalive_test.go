@@ -0,0 +1,113 @@
+package psst
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNulKeepalive(t *testing.T) {
+	client := NewConn(&testTransport{})
+
+	client.state = StateOpen
+	client.client = true
+	client.config = defaultConfig()
+	client.localConfig = DefaultConfig()
+	client.txNextSeq = 1
+	client.txOldestUnacked = 0
+	client.lastSent = time.Now()
+	client.lastReceived = time.Now()
+
+	server := NewConn(&testTransport{})
+
+	server.state = StateOpen
+	server.config = defaultConfig()
+	server.localConfig = DefaultConfig()
+	server.txNextSeq = 1
+	server.rxLastInSeq = 0
+
+	client.keepalive()
+
+	if client.txBuffer.Len() != 0 || client.nulTimer == nil {
+		t.Fatalf("Client sent keepalive before NulTimeout")
+	}
+
+	client.lastSent = time.Now().Add(-millisToDuration(client.config.NulTimeout))
+	client.keepalive()
+
+	segments := client.transport.(*testTransport).segments
+	if len(segments) != 1 || !segments[0].NUL || segments[0].SeqNumber != 1 {
+		t.Fatalf("Client sent %v, expected NUL", segments)
+	}
+
+	validateTxBuffer(client, []uint16{1}, t)
+
+	exchange(client, server, t)
+
+	if server.rxLastInSeq != 1 || server.rxQueue.Len() != 0 {
+		t.Fatalf("Server didn't consume NUL sequence number")
+	}
+
+	validateTxBuffer(client, []uint16{}, t)
+
+	client.closed(nil)
+	server.closed(nil)
+}
+
+func TestDeadPeer(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.localConfig = DefaultConfig()
+	conn.localConfig.DeadPeerMultiple = 2
+	conn.lastReceived = time.Now().Add(-millisToDuration(conn.config.NulTimeout))
+
+	conn.keepalive()
+
+	if conn.state != StateOpen || conn.nulTimer == nil {
+		t.Fatalf("Connection in %v after a single NulTimeout", conn.state)
+	}
+
+	// Segments failing validation don't show the peer is alive
+	conn.lastReceived = time.Now().Add(-2 * millisToDuration(conn.config.NulTimeout))
+	conn.handleSegment(&segment{NUL: true, SeqNumber: 1, Data: []byte{1}})
+	conn.keepalive()
+
+	if conn.state != StateClosed || conn.err != ErrPeerTimeout || conn.nulTimer != nil {
+		t.Fatalf("Connection in %v with error %v after peer went silent", conn.state, conn.err)
+	}
+
+	if segments := transport.take(); len(segments) != 1 || !segments[0].RST {
+		t.Fatalf("Sent %v, expected RST", segments)
+	}
+}
+
+func TestKeepaliveTimers(t *testing.T) {
+	listener := NewConn(&testTransport{})
+	listener.Listen(nil)
+
+	config := DefaultConfig()
+	config.DeadPeerMultiple = 0
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(config)
+
+	exchange(listener, dialer, t)
+
+	if listener.nulTimer == nil || dialer.nulTimer == nil {
+		t.Fatalf("Keepalive timers not armed once connected")
+	}
+
+	listener.mutex.Lock()
+	listener.closed(nil)
+	listener.unlock()
+
+	if listener.nulTimer != nil {
+		t.Fatalf("Keepalive timer not stopped once closed")
+	}
+
+	dialer.mutex.Lock()
+	dialer.closed(nil)
+	dialer.unlock()
+}
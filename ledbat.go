@@ -0,0 +1,152 @@
+package psst
+
+import (
+	"time"
+)
+
+const (
+	// Queuing delay a LEDBAT connection aims for by default, as in RFC 6817
+	ledbatTarget = 100 * time.Millisecond
+	// Segments the window may grow by per window acknowledged at zero
+	// queuing delay
+	ledbatGain = 1
+	// Smallest window, which the connection keeps even when yielding
+	ledbatMinWindow = 2
+	// Segments the window may exceed the segments in flight by, so an
+	// application limited connection doesn't build up an unused window
+	ledbatAllowedIncrease = 1
+	// Number of recent samples the current delay is the minimum of,
+	// filtering out noise
+	ledbatCurrentSamples = 4
+	// The base delay is the minimum over ledbatBaseIntervals intervals of
+	// ledbatBaseInterval, so that it follows route changes
+	ledbatBaseIntervals = 10
+	ledbatBaseInterval  = time.Minute
+)
+
+// ledbat is a delay based controller in the style of LEDBAT (RFC 6817) for
+// background transfers, that gives way to other traffic on the path. It
+// grows the window while the queuing delay it measures is below the target
+// and shrinks it once other traffic pushes the delay above, so it yields to
+// loss based controllers such as NewReno that fill the queues on the path.
+// Unlike RFC 6817 the window shrinks multiplicatively, so a connection with
+// a large window makes way quickly.
+//
+// psst segments carry no timestamps, so the one-way delay is estimated from
+// the round trip time. The queuing delay is the current delay less the
+// lowest delay seen, as queues on the path are assumed to have been empty at
+// some point.
+type ledbat struct {
+	target   time.Duration
+	window   float64
+	inFlight int
+	// Recent delay samples, the current delay is their minimum
+	current []time.Duration
+	// Minimum delay in each recent interval, the newest last
+	base      []time.Duration
+	baseStart time.Time
+	// Segments in flight when loss was detected, to be acknowledged before
+	// a further loss reduces the window again
+	recovery int
+}
+
+// Ledbat returns a LEDBAT-style controller for background connections,
+// aiming for the default 100ms of queuing delay
+func Ledbat() CongestionController {
+	return NewLedbat(ledbatTarget)
+}
+
+// NewLedbat returns a LEDBAT-style controller for background connections,
+// aiming to add at most target of queuing delay to the path
+func NewLedbat(target time.Duration) CongestionController {
+	return &ledbat{
+		target: target,
+		window: initialWindow,
+	}
+}
+
+func (self *ledbat) OnSend(inFlight int) {
+	self.inFlight = inFlight
+}
+
+func (self *ledbat) OnAck(acked int, rtt time.Duration) {
+	if rtt > 0 {
+		self.sample(rtt)
+	}
+
+	if self.recovery > 0 {
+		self.recovery = max(self.recovery-acked, 0)
+		return
+	}
+
+	if len(self.current) == 0 {
+		return
+	}
+
+	queuingDelay := self.currentDelay() - self.baseDelay()
+	offTarget := float64(self.target-queuingDelay) / float64(self.target)
+
+	if offTarget >= 0 {
+		self.window += ledbatGain * offTarget * float64(acked) / self.window
+	} else {
+		// Back off multiplicatively, as in LEDBAT++, by up to half the
+		// window per window acknowledged
+		self.window -= min(-offTarget, 1) * float64(acked) / 2
+	}
+	self.window = min(self.window, float64(self.inFlight+ledbatAllowedIncrease), maxOutstandingSegments)
+	self.window = max(self.window, ledbatMinWindow)
+}
+
+func (self *ledbat) OnLoss(inFlight int) {
+	if self.recovery > 0 {
+		return
+	}
+
+	self.window = max(self.window/2, ledbatMinWindow)
+	self.recovery = max(inFlight, 1)
+}
+
+func (self *ledbat) OnTimeout(inFlight int) {
+	self.window = 1
+	self.recovery = 0
+}
+
+func (self *ledbat) Window() int {
+	return int(self.window)
+}
+
+func (self *ledbat) sample(delay time.Duration) {
+	self.current = append(self.current, delay)
+	if len(self.current) > ledbatCurrentSamples {
+		self.current = self.current[1:]
+	}
+
+	now := time.Now()
+	if len(self.base) == 0 || now.Sub(self.baseStart) >= ledbatBaseInterval {
+		self.base = append(self.base, delay)
+		if len(self.base) > ledbatBaseIntervals {
+			self.base = self.base[1:]
+		}
+		self.baseStart = now
+		return
+	}
+
+	last := len(self.base) - 1
+	self.base[last] = min(self.base[last], delay)
+}
+
+func (self *ledbat) currentDelay() time.Duration {
+	return minDelay(self.current)
+}
+
+func (self *ledbat) baseDelay() time.Duration {
+	return minDelay(self.base)
+}
+
+func minDelay(delays []time.Duration) time.Duration {
+	lowest := delays[0]
+	for _, delay := range delays[1:] {
+		lowest = min(lowest, delay)
+	}
+	return lowest
+}
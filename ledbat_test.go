@@ -0,0 +1,152 @@
+package psst
+
+import (
+	"testing"
+	"time"
+)
+
+// Bottleneck shared by the simulated flows, forwarding simRate segments per
+// simTick through a queue of up to simQueue segments, beyond which segments
+// are dropped
+const (
+	simTick  = time.Millisecond
+	simRate  = 1
+	simQueue = 300
+	simRtt   = 50 * time.Millisecond
+)
+
+type simFlow struct {
+	controller CongestionController
+	inFlight   int
+	delivered  int
+}
+
+type simEvent struct {
+	due  time.Duration
+	flow *simFlow
+	// Time the segment was sent, for the round trip time of its ACK
+	sent time.Duration
+	lost bool
+}
+
+// simulate runs flows through the bottleneck for duration, starting each
+// flow at its offset, and returns the segments each delivered. ACKs for
+// forwarded segments and EAKs showing lost ones arrive simRtt after the
+// segment leaves the bottleneck or is dropped.
+func simulate(controllers []CongestionController, offsets []time.Duration, duration time.Duration) []int {
+	flows := make([]*simFlow, len(controllers))
+	for i, controller := range controllers {
+		flows[i] = &simFlow{controller: controller}
+	}
+
+	var queue, events []simEvent
+	for now := time.Duration(0); now < duration; now += simTick {
+		for i, flow := range flows {
+			if now < offsets[i] {
+				continue
+			}
+
+			for flow.inFlight < max(flow.controller.Window(), 1) {
+				flow.inFlight++
+				flow.controller.OnSend(flow.inFlight)
+
+				if len(queue) >= simQueue {
+					events = append(events, simEvent{due: now + simRtt, flow: flow, lost: true})
+					continue
+				}
+				queue = append(queue, simEvent{flow: flow, sent: now})
+			}
+		}
+
+		for i := 0; i < simRate && len(queue) > 0; i++ {
+			forwarded := queue[0]
+			forwarded.due = now + simRtt
+			events = append(events, forwarded)
+			queue = queue[1:]
+		}
+
+		pending := events[:0]
+		for _, event := range events {
+			if event.due > now {
+				pending = append(pending, event)
+				continue
+			}
+
+			event.flow.inFlight--
+			if event.lost {
+				event.flow.controller.OnLoss(event.flow.inFlight)
+			} else {
+				event.flow.delivered++
+				event.flow.controller.OnAck(1, now-event.sent)
+			}
+		}
+		events = pending
+	}
+
+	delivered := make([]int, len(flows))
+	for i, flow := range flows {
+		delivered[i] = flow.delivered
+	}
+	return delivered
+}
+
+func TestLedbatAlone(t *testing.T) {
+	duration := 60 * time.Second
+	capacity := int(duration / simTick * simRate)
+
+	delivered := simulate([]CongestionController{Ledbat()}, []time.Duration{0}, duration)
+
+	if delivered[0] < capacity*8/10 {
+		t.Fatalf("LEDBAT delivered %d of %d segments on an idle path", delivered[0], capacity)
+	}
+}
+
+func TestLedbatYields(t *testing.T) {
+	duration := 60 * time.Second
+
+	// The background flow has the path to itself for the first 20s
+	delivered := simulate([]CongestionController{Ledbat(), NewReno()}, []time.Duration{0, 20 * time.Second}, duration)
+	alone := simulate([]CongestionController{Ledbat()}, []time.Duration{0}, 20*time.Second)
+
+	background := delivered[0] - alone[0]
+	if background > delivered[1]/10 {
+		t.Fatalf("LEDBAT delivered %d segments alongside NewReno's %d, expected it to yield", background, delivered[1])
+	}
+
+	// While a NewReno flow in its place gets a share of the path
+	delivered = simulate([]CongestionController{NewReno(), NewReno()}, []time.Duration{0, 20 * time.Second}, duration)
+	alone = simulate([]CongestionController{NewReno()}, []time.Duration{0}, 20*time.Second)
+
+	if foreground := delivered[0] - alone[0]; foreground < delivered[1]/4 {
+		t.Fatalf("NewReno delivered %d segments alongside NewReno's %d, expected a share", foreground, delivered[1])
+	}
+}
+
+func TestLedbatWindow(t *testing.T) {
+	controller := NewLedbat(100 * time.Millisecond)
+	controller.OnSend(initialWindow)
+
+	// Without queuing delay the window grows, but not beyond the segments
+	// in flight
+	for i := 0; i < 2*initialWindow; i++ {
+		controller.OnAck(1, 50*time.Millisecond)
+	}
+
+	if window := controller.Window(); window != initialWindow+ledbatAllowedIncrease {
+		t.Fatalf("Window %d without queuing delay, expected %d", window, initialWindow+ledbatAllowedIncrease)
+	}
+
+	// Queuing delay beyond the target shrinks it to the minimum
+	for i := 0; i < 100; i++ {
+		controller.OnAck(1, 250*time.Millisecond)
+	}
+
+	if window := controller.Window(); window != ledbatMinWindow {
+		t.Fatalf("Window %d with queuing delay above target, expected %d", window, ledbatMinWindow)
+	}
+
+	controller.OnTimeout(2)
+	if window := controller.Window(); window != 1 {
+		t.Fatalf("Window %d after timeout, expected 1", window)
+	}
+}
@@ -0,0 +1,130 @@
+package psst
+
+import (
+	"fmt"
+	"time"
+)
+
+// Negotiation is the policy for settling timeouts and limits that differ
+// between the local config and the peer's SYN. Window sizes are not
+// negotiated, each side advertises its own, and the smaller of the two
+// maximum segment sizes is always used.
+//
+// The listener applies its policy to the dialer's offer and reflects the
+// result in its SYN ACK. The dialer accepts the reflected values, unless
+// its policy is NegotiateReject and they differ from its offer.
+type Negotiation uint8
+
+const (
+	// Use the peer's values
+	NegotiateAccept Negotiation = iota
+	// Use the smaller of the local and peer values
+	NegotiateMin
+	// Use the larger of the local and peer values
+	NegotiateMax
+	// Reset the connection unless the peer's values match the local ones
+	NegotiateReject
+)
+
+// negotiateConfig settles the connection config from the local config and
+// the peer's SYN header according to policy
+func negotiateConfig(local *Config, synHeader *synVarHeader, policy Negotiation) (*connConfig, error) {
+	if synHeader.Version != synVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrIncompatibleConfig, synHeader.Version)
+	}
+
+	peer := synHeader.config()
+	if err := peer.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIncompatibleConfig, err)
+	}
+
+	config := &connConfig{
+		MaxSegmentSize:             min(local.MaxSegmentSize, peer.MaxSegmentSize),
+		MaxOutstandingSegmentsSelf: local.MaxOutstandingSegments,
+		MaxOutstandingSegmentsPeer: peer.MaxOutstandingSegments,
+	}
+
+	timeouts := []struct {
+		name        string
+		local, peer time.Duration
+		negotiated  *uint16
+	}{
+		{"RetransmissionTimeout", local.RetransmissionTimeout, peer.RetransmissionTimeout, &config.RetransmissionTimeout},
+		{"CumulativeAckTimeout", local.CumulativeAckTimeout, peer.CumulativeAckTimeout, &config.CumulativeAckTimeout},
+		{"NulTimeout", local.NulTimeout, peer.NulTimeout, &config.NulTimeout},
+	}
+
+	for _, timeout := range timeouts {
+		value, ok := negotiate(policy, durationToMillis(timeout.local), durationToMillis(timeout.peer))
+		if !ok {
+			return nil, fmt.Errorf("%w: %s %v not accepted", ErrIncompatibleConfig, timeout.name, timeout.peer)
+		}
+		*timeout.negotiated = value
+	}
+
+	limits := []struct {
+		name          string
+		local, peer   uint8
+		negotiated    *uint8
+		zeroUnlimited bool
+	}{
+		{"MaxRetransmissions", local.MaxRetransmissions, peer.MaxRetransmissions, &config.MaxRetransmissions, true},
+		{"MaxCumulativeAck", local.MaxCumulativeAck, peer.MaxCumulativeAck, &config.MaxCumulativeAck, false},
+		{"MaxOutOfSeq", local.MaxOutOfSeq, peer.MaxOutOfSeq, &config.MaxOutOfSeq, false},
+		{"MaxAutoReset", local.MaxAutoReset, peer.MaxAutoReset, &config.MaxAutoReset, false},
+	}
+
+	for _, limit := range limits {
+		local, peer := uint16(limit.local), uint16(limit.peer)
+
+		// Order a zero, meaning no limit, above all other values
+		if limit.zeroUnlimited {
+			local, peer = local-1, peer-1
+		}
+
+		value, ok := negotiate(policy, local, peer)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s %d not accepted", ErrIncompatibleConfig, limit.name, limit.peer)
+		}
+
+		if limit.zeroUnlimited {
+			value++
+		}
+		*limit.negotiated = uint8(value)
+	}
+
+	return config, nil
+}
+
+func negotiate(policy Negotiation, local, peer uint16) (uint16, bool) {
+	switch policy {
+
+	case NegotiateMin:
+		return min(local, peer), true
+
+	case NegotiateMax:
+		return max(local, peer), true
+
+	case NegotiateReject:
+		return local, local == peer
+
+	}
+
+	return peer, true
+}
+
+// synHeader reflects the negotiated config back to the peer
+func (self *connConfig) synHeader() *synVarHeader {
+	return &synVarHeader{
+		Version:                synVersion,
+		MaxSegmentSize:         self.MaxSegmentSize,
+		MaxOutstandingSegments: self.MaxOutstandingSegmentsSelf,
+		RetransmissionTimeout:  self.RetransmissionTimeout,
+		CumulativeAckTimeout:   self.CumulativeAckTimeout,
+		NulTimeout:             self.NulTimeout,
+		MaxRetransmissions:     self.MaxRetransmissions,
+		MaxCumulativeAck:       self.MaxCumulativeAck,
+		MaxOutOfSeq:            self.MaxOutOfSeq,
+		MaxAutoReset:           self.MaxAutoReset,
+	}
+}
@@ -0,0 +1,141 @@
+package psst
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiationPolicies(t *testing.T) {
+	offer := DefaultConfig()
+	offer.MaxSegmentSize = 1024
+	offer.MaxOutstandingSegments = 16
+	offer.RetransmissionTimeout = time.Second
+	offer.MaxRetransmissions = 0
+	offer.MaxCumulativeAck = 16
+
+	input := []struct {
+		policy                Negotiation
+		retransmissionTimeout uint16
+		maxRetransmissions    uint8
+		maxCumulativeAck      uint8
+	}{
+		{NegotiateAccept, 1000, 0, 16},
+		{NegotiateMin, 1000, 4, 8},
+		{NegotiateMax, 2000, 0, 16},
+	}
+
+	for _, i := range input {
+		config, err := negotiateConfig(DefaultConfig(), offer.synHeader(), i.policy)
+		if err != nil {
+			t.Fatalf("Negotiation with policy %d failed: %v", i.policy, err)
+		}
+
+		if config.MaxSegmentSize != 1024 || config.MaxOutstandingSegmentsSelf != 32 || config.MaxOutstandingSegmentsPeer != 16 {
+			t.Fatalf("Negotiated segment size and windows %+v don't match expected", config)
+		}
+
+		if config.RetransmissionTimeout != i.retransmissionTimeout || config.MaxRetransmissions != i.maxRetransmissions || config.MaxCumulativeAck != i.maxCumulativeAck {
+			t.Fatalf("Negotiated config %+v with policy %d doesn't match expected %+v", config, i.policy, i)
+		}
+
+		if config.CumulativeAckTimeout != 300 || config.NulTimeout != 30000 {
+			t.Fatalf("Negotiated config %+v changed matching values", config)
+		}
+	}
+
+	if _, err := negotiateConfig(DefaultConfig(), offer.synHeader(), NegotiateReject); !errors.Is(err, ErrIncompatibleConfig) {
+		t.Fatalf("Negotiation with reject policy failed with %v, expected incompatible config", err)
+	}
+
+	if _, err := negotiateConfig(DefaultConfig(), DefaultConfig().synHeader(), NegotiateReject); err != nil {
+		t.Fatalf("Negotiation of matching configs with reject policy failed: %v", err)
+	}
+}
+
+func TestIncompatibleOffer(t *testing.T) {
+	input := []func(*synVarHeader){
+		func(synHeader *synVarHeader) { synHeader.Version = 2 },
+		func(synHeader *synVarHeader) { synHeader.MaxSegmentSize = 0 },
+		func(synHeader *synVarHeader) { synHeader.NulTimeout = synHeader.RetransmissionTimeout },
+	}
+
+	for _, modify := range input {
+		synHeader := DefaultConfig().synHeader()
+		modify(synHeader)
+
+		if _, err := negotiateConfig(DefaultConfig(), synHeader, NegotiateAccept); !errors.Is(err, ErrIncompatibleConfig) {
+			t.Fatalf("Negotiation of SYN %+v failed with %v, expected incompatible config", synHeader, err)
+		}
+	}
+}
+
+func TestNegotiatedHandshake(t *testing.T) {
+	listenerConfig := DefaultConfig()
+	listenerConfig.MaxOutstandingSegments = 64
+	listenerConfig.NulTimeout = 20 * time.Second
+	listenerConfig.Negotiation = NegotiateMin
+
+	dialerConfig := DefaultConfig()
+	dialerConfig.MaxSegmentSize = 1024
+	dialerConfig.RetransmissionTimeout = 5 * time.Second
+
+	listener := NewConn(&testTransport{})
+	listener.Listen(listenerConfig)
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(dialerConfig)
+
+	exchange(listener, dialer, t)
+
+	if listener.state != StateOpen || dialer.state != StateOpen {
+		t.Fatalf("Handshake ended with listener in %v and dialer in %v", listener.state, dialer.state)
+	}
+
+	expected := connConfig{
+		MaxSegmentSize:             1024,
+		MaxOutstandingSegmentsSelf: 64,
+		MaxOutstandingSegmentsPeer: 32,
+		RetransmissionTimeout:      2000,
+		CumulativeAckTimeout:       300,
+		NulTimeout:                 20000,
+		MaxRetransmissions:         4,
+		MaxCumulativeAck:           8,
+		MaxOutOfSeq:                8,
+		MaxAutoReset:               3,
+	}
+
+	if *listener.config != expected {
+		t.Fatalf("Listener config %+v doesn't match expected %+v", listener.config, expected)
+	}
+
+	expected.MaxOutstandingSegmentsSelf, expected.MaxOutstandingSegmentsPeer = 32, 64
+	if *dialer.config != expected {
+		t.Fatalf("Dialer config %+v doesn't match expected %+v", dialer.config, expected)
+	}
+}
+
+func TestRejectedHandshake(t *testing.T) {
+	listenerConfig := DefaultConfig()
+	listenerConfig.Negotiation = NegotiateReject
+
+	dialerConfig := DefaultConfig()
+	dialerConfig.MaxRetransmissions = 8
+
+	listener := NewConn(&testTransport{})
+	listener.Listen(listenerConfig)
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(dialerConfig)
+
+	exchange(listener, dialer, t)
+
+	if listener.state != StateClosed || !errors.Is(listener.err, ErrIncompatibleConfig) {
+		t.Fatalf("Listener in %v with error %v after rejecting SYN", listener.state, listener.err)
+	}
+
+	if dialer.state != StateClosed || !errors.Is(dialer.err, ErrConnectionReset) || !strings.Contains(dialer.err.Error(), "MaxRetransmissions 8 not accepted") {
+		t.Fatalf("Dialer in %v with error %v after rejected SYN", dialer.state, dialer.err)
+	}
+}
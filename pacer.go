@@ -0,0 +1,97 @@
+package psst
+
+import (
+	"time"
+)
+
+// Segments are paced at pacingGain times the congestion window per smoothed
+// round trip time, a little faster than the window so that pacing doesn't
+// hold the connection below it
+const pacingGain = 1.25
+
+// send transmits a tx buffer entry once the pacer allows. Entries waiting
+// for the pacer are sent in the order they were queued.
+func (self *conn) send(entry *txBufferEntry) {
+	if self.paceQueue.Len() == 0 && self.paceReady() {
+		self.sendPaced(entry)
+		return
+	}
+
+	entry.paced = true
+	self.paceQueue.PushBack(entry)
+
+	if self.paceTimer == nil {
+		self.paceTimer = time.AfterFunc(time.Until(self.nextSend), self.paceTimerExpired)
+	}
+}
+
+// paceReady reports whether the next segment is due. Timers can't wait for
+// less than the clock granularity, so segments due within it go right away.
+func (self *conn) paceReady() bool {
+	return time.Until(self.nextSend) < clockGranularity
+}
+
+func (self *conn) paceTimerExpired() {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	self.paceTimer = nil
+
+	for self.paceQueue.Len() > 0 && self.paceReady() {
+		entry := self.paceQueue.Remove(self.paceQueue.Front()).(*txBufferEntry)
+
+		// Skip entries acknowledged while waiting
+		if entry.paced {
+			entry.paced = false
+			self.sendPaced(entry)
+		}
+	}
+
+	if self.paceQueue.Len() > 0 {
+		self.paceTimer = time.AfterFunc(time.Until(self.nextSend), self.paceTimerExpired)
+	}
+}
+
+// sendPaced sends an entry and schedules the next one after the pacing
+// interval
+func (self *conn) sendPaced(entry *txBufferEntry) {
+	self.sendData(entry)
+
+	if now := time.Now(); self.nextSend.Before(now) {
+		self.nextSend = now
+	}
+	self.nextSend = self.nextSend.Add(self.pacingInterval(len(entry.Data)))
+
+	if self.retransmissionTimer == nil {
+		self.armRetransmissionTimer()
+	}
+	self.armTailLossProbe()
+}
+
+// pacingInterval is the time to wait after sending size octets of data. The
+// window is not paced until the round trip time has been measured.
+func (self *conn) pacingInterval(size int) time.Duration {
+	var interval time.Duration
+	if self.srtt != 0 {
+		interval = time.Duration(float64(self.srtt) / (pacingGain * float64(self.congestionWindow())))
+	}
+
+	if self.localConfig != nil && self.localConfig.MaxSendRate > 0 {
+		interval = max(interval, time.Duration(size)*time.Second/time.Duration(self.localConfig.MaxSendRate))
+	}
+
+	return interval
+}
+
+// stopPacer drops the entries waiting for the pacer
+func (self *conn) stopPacer() {
+	if self.paceTimer != nil {
+		self.paceTimer.Stop()
+		self.paceTimer = nil
+	}
+
+	for element := self.paceQueue.Front(); element != nil; element = element.Next() {
+		element.Value.(*txBufferEntry).paced = false
+	}
+	self.paceQueue.Init()
+}
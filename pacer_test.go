@@ -0,0 +1,84 @@
+package psst
+
+import (
+	"testing"
+	"time"
+)
+
+// waitSent waits for count segments to be sent, returning the time the
+// last one was seen
+func waitSent(transport *testTransport, count int, t *testing.T) ([]*segment, time.Time) {
+	var segments []*segment
+	for start := time.Now(); len(segments) < count; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Sent %v, expected %d segments", segments, count)
+		}
+		segments = append(segments, transport.take()...)
+	}
+
+	return segments, time.Now()
+}
+
+func TestPacing(t *testing.T) {
+	conn := windowConn()
+	conn.config.MaxOutstandingSegmentsPeer = 10
+	conn.congestion = &recordingController{window: 4}
+	conn.srtt = 100 * time.Millisecond
+	transport := conn.transport.(*testTransport)
+
+	// A window per round trip is a segment every 20ms
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		conn.Write([]byte{byte(i)})
+	}
+
+	if segments := transport.take(); len(segments) != 1 || segments[0].SeqNumber != 1 {
+		t.Fatalf("Sent %v right away, expected the first segment only", segments)
+	}
+
+	segments, end := waitSent(transport, 2, t)
+	if segments[0].SeqNumber != 2 || segments[1].SeqNumber != 3 {
+		t.Fatalf("Paced segments %v don't match expected", segments)
+	}
+
+	if elapsed := end.Sub(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("Segments sent within %v, expected them spread over 40ms", elapsed)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
+
+func TestMaxSendRate(t *testing.T) {
+	conn := windowConn()
+	conn.config.MaxOutstandingSegmentsPeer = 10
+	conn.localConfig = DefaultConfig()
+	conn.localConfig.MaxSendRate = 1000
+	transport := conn.transport.(*testTransport)
+
+	// 10 octets at 1000 octets per second is a segment every 10ms
+	start := time.Now()
+	conn.Write(make([]byte, 10))
+	conn.Write(make([]byte, 10))
+	conn.Write(make([]byte, 10))
+
+	_, end := waitSent(transport, 3, t)
+	if elapsed := end.Sub(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("Segments sent within %v, expected them spread over 20ms", elapsed)
+	}
+
+	// Entries waiting for the pacer are dropped on close
+	conn.Write(make([]byte, 10))
+	conn.Write(make([]byte, 10))
+	transport.take()
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	if segments := transport.take(); len(segments) != 0 {
+		t.Fatalf("Sent %v once closed", segments)
+	}
+}
@@ -0,0 +1,194 @@
+package psst
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Path payload size discovery finds the largest segment the route to the
+// peer delivers, in the manner of packetization layer path MTU discovery
+// (RFC 8899). Segments no larger than basePayloadSize are assumed to be
+// delivered by any route. From there a binary search probes larger sizes
+// with NUL segments padded to the size, which the peer answers with an ACK
+// echoing the size. A size is given up on after maxPathProbes unanswered
+// probes.
+//
+// Probes don't take a sequence number, so a lost probe costs neither a
+// retransmission nor a gap in the sequence. The confirmed size caps the data
+// of new stream segments, while messages written with Write are bound only by
+// the negotiated MaxSegmentSize so that whether a Write fits doesn't depend on
+// the progress of the search. Should the route shrink, segments of the old size are
+// lost and retransmitted, and once one has been retransmitted twice the
+// size falls back to basePayloadSize and the search starts over. Segments
+// already sent at the old size can't be split, so they are left to
+// retransmission and, if need be, an auto reset.
+
+const (
+	// Payload size delivered by any route
+	basePayloadSize = 1024
+	// The search ends once the sizes known to work and to fail are closer
+	// than this
+	pathProbeGranularity = 32
+	// Probes of a size that go unanswered before it is given up on
+	maxPathProbes = 3
+	// Fixed header and window of a data segment
+	dataOverhead = 10
+)
+
+// pathSearch is the state of path payload size discovery
+type pathSearch struct {
+	// Largest payload confirmed to be delivered, zero while discovery is
+	// disabled
+	size int
+	// Sizes known to work and the largest not known to fail while searching
+	low, high int
+	// Size being probed, and the number of probes sent of it
+	probeSize  int
+	probeCount int
+	timer      *time.Timer
+}
+
+func (self *conn) pathDiscovery() bool {
+	return self.localConfig != nil && self.localConfig.PathProbeInterval > 0
+}
+
+// maxPayloadSize is the largest payload of a data segment of up to the
+// negotiated MaxSegmentSize
+func (self *conn) maxPayloadSize() int {
+	return int(self.config.MaxSegmentSize) + dataOverhead
+}
+
+// streamSegmentSize is the largest data payload of a stream segment, within
+// both the negotiated MaxSegmentSize and the size the route delivers
+func (self *conn) streamSegmentSize() int {
+	if self.path.size == 0 {
+		return int(self.config.MaxSegmentSize)
+	}
+
+	return min(int(self.config.MaxSegmentSize), self.path.size-dataOverhead)
+}
+
+// maxEaks is the number of EAKs that fit in a segment with size octets of
+// data on the route
+func (self *conn) maxEaks(size int) int {
+	if self.path.size == 0 {
+		return maxEakNumbers
+	}
+
+	return min(maxEakNumbers, max(self.path.size-dataOverhead-size, 0)/2)
+}
+
+// startPathSearch searches for the path payload size from the base size
+// once the connection opens
+func (self *conn) startPathSearch() {
+	if !self.pathDiscovery() {
+		return
+	}
+
+	self.path.size = min(basePayloadSize, self.maxPayloadSize())
+	self.searchPath()
+}
+
+// searchPath searches for a size larger than the confirmed one
+func (self *conn) searchPath() {
+	self.stopPathSearch()
+	self.path.low = self.path.size
+	self.path.high = self.maxPayloadSize()
+	self.probePath()
+}
+
+// probePath probes the next size of the search, or schedules the next
+// search once it has ended
+func (self *conn) probePath() {
+	if self.path.high-self.path.low < pathProbeGranularity {
+		self.path.probeSize = 0
+		self.path.timer = time.AfterFunc(self.localConfig.PathProbeInterval, self.pathTimerExpired)
+		return
+	}
+
+	self.path.probeSize = (self.path.low + self.path.high + 1) / 2
+	self.path.probeCount = 0
+	self.sendPathProbe()
+}
+
+func (self *conn) sendPathProbe() {
+	self.path.probeCount++
+	self.sendSegment(&segment{
+		ACK:       true,
+		NUL:       true,
+		PRB:       true,
+		SeqNumber: self.txNextSeq,
+		AckNumber: self.rxLastInSeq,
+		Data:      make([]byte, self.path.probeSize-dataOverhead),
+	})
+
+	self.path.timer = time.AfterFunc(self.retransmissionTimeout(), self.pathTimerExpired)
+}
+
+func (self *conn) pathTimerExpired() {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	self.path.timer = nil
+	if self.state != StateOpen {
+		return
+	}
+
+	switch {
+
+	// The search interval has passed
+	case self.path.probeSize == 0:
+		self.searchPath()
+
+	case self.path.probeCount < maxPathProbes:
+		self.sendPathProbe()
+
+	default:
+		self.path.high = self.path.probeSize - 1
+		self.probePath()
+
+	}
+}
+
+// receivedPathProbe answers a probe from the peer, or confirms the size of
+// one of ours
+func (self *conn) receivedPathProbe(probe *segment) {
+	if probe.NUL {
+		size := make([]byte, 2)
+		binary.BigEndian.PutUint16(size, uint16(len(probe.Data)+dataOverhead))
+
+		self.sendSegment(&segment{
+			ACK:       true,
+			PRB:       true,
+			SeqNumber: self.txNextSeq,
+			AckNumber: self.rxLastInSeq,
+			Data:      size,
+		})
+		return
+	}
+
+	if size := int(binary.BigEndian.Uint16(probe.Data)); size == self.path.probeSize && self.path.timer != nil {
+		self.stopPathSearch()
+		self.path.size = size
+		self.path.low = size
+		self.probePath()
+	}
+}
+
+// pathBlackHole falls back to the base size once a segment larger than it
+// has timed out twice, as the route may have shrunk
+func (self *conn) pathBlackHole(entry *txBufferEntry) {
+	if self.path.size <= basePayloadSize || entry.timeouts < 2 || len(entry.Data)+dataOverhead <= basePayloadSize {
+		return
+	}
+
+	self.path.size = basePayloadSize
+	self.searchPath()
+}
+
+func (self *conn) stopPathSearch() {
+	if self.path.timer != nil {
+		self.path.timer.Stop()
+		self.path.timer = nil
+	}
+}
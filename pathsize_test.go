@@ -0,0 +1,155 @@
+package psst
+
+import (
+	"testing"
+	"time"
+)
+
+// routeExchange delivers segments between two conns over a route that drops
+// segments larger than limit, expiring probes of the search on a until it
+// has ended
+func routeExchange(a, b *conn, limit int, t *testing.T) {
+	for {
+		for _, pair := range [][2]*conn{{a, b}, {b, a}} {
+			for _, segment := range pair[0].transport.(*testTransport).take() {
+				if data := marshalSegment(segment, t); len(data) <= limit {
+					pair[1].Receive(data)
+				}
+			}
+		}
+
+		a.mutex.Lock()
+		probing := a.path.probeSize != 0
+		if probing {
+			a.stopPathSearch()
+		}
+		a.unlock()
+
+		if !probing {
+			return
+		}
+		a.pathTimerExpired()
+	}
+}
+
+func TestPathDiscovery(t *testing.T) {
+	config := transferConfig()
+	config.MaxSegmentSize = 2048
+
+	listener := NewConn(&testTransport{})
+	listener.Listen(config)
+
+	// Only the dialer searches, the listener just answers its probes
+	dialerConfig := transferConfig()
+	dialerConfig.MaxSegmentSize = 2048
+	dialerConfig.PathProbeInterval = time.Hour
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(dialerConfig)
+
+	routeExchange(dialer, listener, 1500, t)
+
+	if stats := dialer.Stats(); stats.PathPayloadSize <= 1500-pathProbeGranularity || stats.PathPayloadSize > 1500 {
+		t.Fatalf("Stats %+v on a route of 1500 octets", stats)
+	}
+
+	if size := listener.Stats().PathPayloadSize; size != 0 {
+		t.Fatalf("Listener found a payload size of %d with discovery disabled", size)
+	}
+
+	// Stream writes are split to the size found
+	dialer.Stream().Write(make([]byte, 2048))
+	segments := dialer.transport.(*testTransport).take()
+	if len(segments) != 2 || len(segments[0].Data) != dialer.path.size-dataOverhead {
+		t.Fatalf("Sent %v, expected segments within the path payload size", segments)
+	}
+
+	// Messages are bound by the negotiated MaxSegmentSize alone
+	if err := dialer.Write(make([]byte, 2048)); err != nil {
+		t.Fatalf("Write within MaxSegmentSize failed with %v", err)
+	}
+
+	closePair(listener, dialer)
+}
+
+func TestPathBlackHole(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.localConfig = DefaultConfig()
+	conn.localConfig.PathProbeInterval = time.Hour
+	conn.config = defaultConfig()
+	conn.config.MaxSegmentSize = 2048
+	conn.path.size = 2058
+
+	conn.Write(make([]byte, 2048))
+
+	// Retransmissions other than on the timeout are no evidence
+	entry := conn.txBuffer.Front().Value.(*txBufferEntry)
+	for i := 0; i < 2; i++ {
+		conn.retransmitEntry(entry)
+	}
+
+	if conn.path.size != 2058 {
+		t.Fatalf("Path payload size %d after fast retransmissions, expected 2058", conn.path.size)
+	}
+
+	// The route has shrunk, so the segment goes unacknowledged
+	for i := 0; i < 2; i++ {
+		conn.txBuffer.Front().Value.(*txBufferEntry).sentAt = time.Time{}
+		conn.retransmit()
+	}
+
+	if conn.path.size != basePayloadSize {
+		t.Fatalf("Path payload size %d after retransmitting twice, expected %d", conn.path.size, basePayloadSize)
+	}
+
+	// The search starts over from the base size
+	segments := transport.take()
+	if probe := segments[len(segments)-1]; !probe.PRB || !probe.NUL || len(probe.Data) != (basePayloadSize+2058+1)/2-dataOverhead {
+		t.Fatalf("Sent %v, expected a probe above the base size", segments)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
+
+func TestPathShrinkStream(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.localConfig = DefaultConfig()
+	conn.localConfig.PathProbeInterval = time.Hour
+	conn.localConfig.CoalesceWrites = true
+	conn.config = defaultConfig()
+	conn.config.MaxSegmentSize = 2048
+	conn.path.size = 2058
+	stream := conn.Stream()
+
+	// Data is held back while a segment is outstanding
+	stream.Write([]byte{0})
+	stream.Write(make([]byte, 1500))
+
+	// Once the route shrinks the held back data goes out in segments it
+	// delivers
+	conn.path.size = basePayloadSize
+	if written, err := stream.Write(make([]byte, 100)); written != 100 || err != nil {
+		t.Fatalf("Stream wrote %d with %v after the path shrank", written, err)
+	}
+
+	segments := transport.take()
+	if len(segments) != 3 || len(segments[1].Data) != basePayloadSize-dataOverhead || len(segments[2].Data) != 1500-(basePayloadSize-dataOverhead) {
+		t.Fatalf("Sent %v, expected the held back data split to the path payload size", segments)
+	}
+
+	if len(conn.txPending) != 100 {
+		t.Fatalf("%d bytes held back, expected 100", len(conn.txPending))
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
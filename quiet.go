@@ -0,0 +1,203 @@
+package psst
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// PeerTransport is a Transport that identifies the peer it carries segments
+// to, such as by its PSS address. The quiet periods of connections closed to
+// a peer then keep stale segments out of new connections on any conn over a
+// transport to the same peer, rather than only on the conn that was closed.
+type PeerTransport interface {
+	Transport
+	Peer() string
+}
+
+// quietPeriod remembers the identifier and sequence numbers of a closed
+// connection for QuietPeriod, so that its delayed segments are not mistaken
+// for segments of a later connection to the same peer
+type quietPeriod struct {
+	until time.Time
+	// Identifier of the connection, zero if the handshake didn't complete,
+	// and the local initial sequence number it was made from
+	id           uint32
+	txInitialSeq uint16
+	// Next local sequence number and, once the peer's SYN had been received,
+	// last in sequence number from the peer
+	txNextSeq   uint16
+	rxLastInSeq uint16
+	peer        bool
+	// Distance from either sequence number that delayed segments may have
+	window uint16
+}
+
+// quietPeers holds the quiet periods of the connections closed to each peer
+// identified by a PeerTransport
+var quietPeers = struct {
+	sync.Mutex
+	periods map[string][]*quietPeriod
+}{periods: make(map[string][]*quietPeriod)}
+
+// startQuietPeriod records the identifier and sequence numbers of a
+// connection as it closes. A suspended connection lives on elsewhere, so its
+// segments are neither stale nor answered with RST.
+func (self *conn) startQuietPeriod(err error) {
+	if err == ErrTransferred {
+		self.quiet = nil
+		return
+	}
+
+	if self.localConfig == nil || self.localConfig.QuietPeriod == 0 {
+		return
+	}
+
+	switch self.state {
+
+	case StateSynSent, StateSynReceived, StateOpen, StateCloseWait:
+		window := self.localConfig.MaxOutstandingSegments
+		if self.config != nil {
+			window = max(self.config.MaxOutstandingSegmentsSelf, self.config.MaxOutstandingSegmentsPeer)
+		}
+
+		self.quiet = &quietPeriod{
+			until:        time.Now().Add(self.localConfig.QuietPeriod),
+			id:           self.id,
+			txInitialSeq: self.txInitialSeq,
+			txNextSeq:    self.txNextSeq,
+			rxLastInSeq:  self.rxLastInSeq,
+			peer:         self.state != StateSynSent,
+			window:       2 * window,
+		}
+		self.addQuietPeriod(self.quiet)
+
+	}
+}
+
+// quietPeriod returns the quiet period of the connection last closed on the
+// conn, nil once it has ended
+func (self *conn) quietPeriod() *quietPeriod {
+	if self.quiet != nil && !time.Now().Before(self.quiet.until) {
+		self.quiet = nil
+	}
+
+	return self.quiet
+}
+
+// quietPeriods returns the quiet periods of the connections closed to the
+// peer, or on the conn when the transport doesn't identify the peer
+func (self *conn) quietPeriods() []*quietPeriod {
+	peer, ok := self.transport.(PeerTransport)
+	if !ok {
+		self.closedPeriods = livePeriods(self.closedPeriods)
+		return self.closedPeriods
+	}
+
+	quietPeers.Lock()
+	defer quietPeers.Unlock()
+
+	periods := livePeriods(quietPeers.periods[peer.Peer()])
+	if len(periods) == 0 {
+		delete(quietPeers.periods, peer.Peer())
+	} else {
+		quietPeers.periods[peer.Peer()] = periods
+	}
+
+	return periods
+}
+
+func (self *conn) addQuietPeriod(quiet *quietPeriod) {
+	peer, ok := self.transport.(PeerTransport)
+	if !ok {
+		self.closedPeriods = append(livePeriods(self.closedPeriods), quiet)
+		return
+	}
+
+	quietPeers.Lock()
+	defer quietPeers.Unlock()
+
+	quietPeers.periods[peer.Peer()] = append(livePeriods(quietPeers.periods[peer.Peer()]), quiet)
+}
+
+// livePeriods returns a copy of periods without those that have ended
+func livePeriods(periods []*quietPeriod) []*quietPeriod {
+	now := time.Now()
+
+	var live []*quietPeriod
+	for _, quiet := range periods {
+		if now.Before(quiet.until) {
+			live = append(live, quiet)
+		}
+	}
+
+	return live
+}
+
+// initialSeqNumber picks a random initial sequence number, avoiding those
+// the peer may still consider part of a connection in its quiet period and
+// those that would give a new connection the same identifier. The peer's last
+// in sequence number lags ours by up to a window, so twice the window is kept
+// clear. With windows too large to keep clear the last pick is used.
+func (self *conn) initialSeqNumber() uint16 {
+	periods := self.quietPeriods()
+	for i := 0; ; i++ {
+		initialSeqNumber := uint16(rand.Int())
+		if i == maxInitialSeqPicks || !reusesSeqNumber(periods, initialSeqNumber) {
+			return initialSeqNumber
+		}
+	}
+}
+
+const maxInitialSeqPicks = 64
+
+func reusesSeqNumber(periods []*quietPeriod, initialSeqNumber uint16) bool {
+	for _, quiet := range periods {
+		if near(initialSeqNumber, quiet.txNextSeq, 2*quiet.window) || quiet.id != 0 && initialSeqNumber == quiet.txInitialSeq {
+			return true
+		}
+	}
+
+	return false
+}
+
+// staleHandshake reports whether a handshake segment from the peer may belong
+// to a connection closed to it during its quiet period, by its sequence
+// number for a SYN, by its acknowledgement number for a SYN ACK that doesn't
+// acknowledge the local SYN, or by the identifier it would give the new
+// connection
+func (self *conn) staleHandshake(segment *segment) bool {
+	id := connID(self.client, self.txNextSeq-1, segment.SeqNumber)
+	for _, quiet := range self.quietPeriods() {
+		if quiet.id != 0 && quiet.id == id {
+			return true
+		}
+
+		if !segment.ACK && quiet.staleSeq(segment.SeqNumber) || segment.ACK && segment.AckNumber != self.txNextSeq-1 && quiet.staleAck(segment.AckNumber) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// staleSeq reports whether a sequence number from the peer may belong to
+// the closed connection
+func (self *quietPeriod) staleSeq(seqNumber uint16) bool {
+	return self.peer && near(seqNumber, self.rxLastInSeq, self.window)
+}
+
+// staleAck reports whether an acknowledgement number from the peer may
+// belong to the closed connection
+func (self *quietPeriod) staleAck(ackNumber uint16) bool {
+	return near(ackNumber, self.txNextSeq, self.window)
+}
+
+func (self *quietPeriod) stale(segment *segment) bool {
+	return self.staleSeq(segment.SeqNumber) || segment.ACK && self.staleAck(segment.AckNumber)
+}
+
+func near(a, b, distance uint16) bool {
+	diff := int(int16(a - b))
+	return -int(distance) <= diff && diff <= int(distance)
+}
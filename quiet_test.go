@@ -0,0 +1,155 @@
+package psst
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuietPeriod(t *testing.T) {
+	config := DefaultConfig()
+	config.RetransmissionTimeout = 10 * time.Second
+	config.CumulativeAckTimeout = 5 * time.Second
+
+	listener := NewConn(&testTransport{})
+	listener.Listen(config)
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(config)
+
+	exchange(listener, dialer, t)
+
+	// The listener closes while the dialer's segment is delayed
+	dialer.Write([]byte{0xa})
+	delayed := marshalSegment(dialer.transport.(*testTransport).take()[0], t)
+
+	handler := &recordingHandler{}
+	listener.SetHandler(handler)
+	listener.mutex.Lock()
+	listener.closed(nil)
+	listener.unlock()
+
+	if err := listener.Receive(delayed); !errors.Is(err, ErrStaleSegment) {
+		t.Fatalf("Delayed segment failed with %v, expected stale segment", err)
+	}
+
+	segments := listener.transport.(*testTransport).take()
+	if len(segments) != 1 || !segments[0].RST || listener.state != StateClosed {
+		t.Fatalf("Listener sent %v in %v, expected RST", segments, listener.state)
+	}
+
+	validateEvents(handler, []string{
+		"state StateOpen StateClosed",
+		"close <nil>",
+	}, t)
+
+	dialer.Receive(marshalSegment(segments[0], t))
+	if dialer.state != StateClosed || !errors.Is(dialer.err, ErrConnectionReset) {
+		t.Fatalf("Dialer in %v with error %v after RST", dialer.state, dialer.err)
+	}
+
+	// Neither side accepts segments of the old connection in a new one
+	listener.Listen(config)
+	staleSyn := &segment{SYN: true, SeqNumber: listener.quiet.rxLastInSeq - 1, VarHeader: config.synHeader()}
+	if err := listener.Receive(marshalSegment(staleSyn, t)); !errors.Is(err, ErrStaleSegment) || listener.state != StateListen {
+		t.Fatalf("Stale SYN failed with %v in %v, expected stale segment", err, listener.state)
+	}
+
+	dialer.Dial(config)
+	staleSynAck := &segment{SYN: true, ACK: true, SeqNumber: listener.txNextSeq - 1, AckNumber: dialer.quiet.txNextSeq - 1, VarHeader: config.synHeader()}
+	if err := dialer.Receive(marshalSegment(staleSynAck, t)); !errors.Is(err, ErrStaleSegment) || dialer.state != StateSynSent {
+		t.Fatalf("Stale SYN ACK failed with %v in %v, expected stale segment", err, dialer.state)
+	}
+
+	exchange(listener, dialer, t)
+
+	if listener.state != StateOpen || dialer.state != StateOpen {
+		t.Fatalf("Connection in %v and %v after quiet period", listener.state, dialer.state)
+	}
+
+	closePair(listener, dialer)
+}
+
+func TestQuietPeriodEnd(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.localConfig = DefaultConfig()
+	conn.rxLastInSeq = 0x1234
+	conn.closed(nil)
+
+	for i := 0; i < 1000; i++ {
+		if initialSeqNumber := conn.initialSeqNumber(); near(initialSeqNumber, conn.quiet.txNextSeq, 2*conn.quiet.window) {
+			t.Fatalf("Initial sequence number %d reused during quiet period", initialSeqNumber)
+		}
+	}
+
+	segment := &segment{SeqNumber: 0x1235, Data: []byte{0}}
+	if action, err := conn.validateSegment(segment); action != ActionReset || !errors.Is(err, ErrStaleSegment) {
+		t.Fatalf("Segment validated with %v during quiet period, expected RST", err)
+	}
+
+	conn.quiet.until = time.Now()
+	if action, err := conn.validateSegment(segment); action != ActionDiscard || !errors.Is(err, ErrUnexpectedSegment) || conn.quiet != nil {
+		t.Fatalf("Segment validated with %v after quiet period, expected discard", err)
+	}
+}
+
+func TestQuietPeriodAcrossConns(t *testing.T) {
+	config := transferConfig()
+
+	listener := NewConn(&peerTransport{peer: "quiet dialer"})
+	listener.Listen(config)
+
+	dialer := NewConn(&peerTransport{peer: "quiet listener"})
+	dialer.Dial(config)
+
+	exchange(listener, dialer, t)
+
+	listener.mutex.Lock()
+	listener.closed(nil)
+	listener.unlock()
+
+	// A new conn to the same peer keeps clear of the closed connection
+	next := NewConn(&peerTransport{peer: "quiet dialer"})
+	next.Listen(config)
+
+	for i := 0; i < 1000; i++ {
+		if initialSeqNumber := next.initialSeqNumber(); initialSeqNumber == listener.txInitialSeq || near(initialSeqNumber, listener.quiet.txNextSeq, 2*listener.quiet.window) {
+			t.Fatalf("Initial sequence number %d of the closed connection reused", initialSeqNumber)
+		}
+	}
+
+	staleSyn := &segment{SYN: true, SeqNumber: listener.quiet.rxLastInSeq - 1, VarHeader: config.synHeader()}
+	if err := next.Receive(marshalSegment(staleSyn, t)); !errors.Is(err, ErrStaleSegment) || next.state != StateListen {
+		t.Fatalf("Stale SYN failed with %v in %v, expected stale segment", err, next.state)
+	}
+
+	// Once the sequence of the closed connection has moved on, its
+	// identifier still gives a repeated SYN away
+	next.mutex.Lock()
+	listener.quiet.rxLastInSeq += 0x4000
+	next.txNextSeq = listener.txInitialSeq + 1
+	next.unlock()
+
+	repeatedSyn := &segment{SYN: true, SeqNumber: listener.rxInitialSeq, VarHeader: config.synHeader()}
+	if err := next.Receive(marshalSegment(repeatedSyn, t)); !errors.Is(err, ErrStaleSegment) || next.state != StateListen {
+		t.Fatalf("SYN reusing the identifier failed with %v in %v, expected stale segment", err, next.state)
+	}
+
+	// Conns to other peers are unaffected
+	other := NewConn(&peerTransport{peer: "quiet other"})
+	other.Listen(config)
+	other.txNextSeq = listener.txInitialSeq + 1
+
+	if err := other.Receive(marshalSegment(repeatedSyn, t)); err != nil || other.state != StateSynReceived {
+		t.Fatalf("SYN to another peer failed with %v in %v", err, other.state)
+	}
+
+	for _, conn := range []*conn{dialer, next, other} {
+		conn.mutex.Lock()
+		conn.closed(nil)
+		conn.unlock()
+	}
+}
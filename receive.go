@@ -0,0 +1,130 @@
+package psst
+
+import (
+	"context"
+	"io"
+	"iter"
+)
+
+// ReadMessage returns the next in-order data payload, blocking until one
+// is available. Once the connection is closed and all data has been read it
+// returns the error the connection was closed with, or io.EOF.
+func (self *conn) ReadMessage() ([]byte, error) {
+	return self.nextMessage(context.Background(), 0)
+}
+
+// Messages returns an iterator over in-order data payloads. Iteration ends
+// after the last payload of a cleanly closed connection, or with a final
+// error.
+func (self *conn) Messages() iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for {
+			message, err := self.ReadMessage()
+			if err == io.EOF {
+				return
+			}
+
+			if !yield(message, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Subscribe returns a channel delivering in-order data payloads. The channel
+// is closed once the connection is closed and all data has been delivered,
+// or when ctx is done, Err then reports why the connection closed. Payloads
+// are taken off the receive queue only as the channel is read, so a slow
+// subscriber shrinks the receive window in the same way as a slow reader.
+func (self *conn) Subscribe(ctx context.Context) <-chan []byte {
+	messages := make(chan []byte)
+
+	go func() {
+		defer close(messages)
+
+		for {
+			message, err := self.nextMessage(ctx, 0)
+			if err != nil {
+				return
+			}
+
+			select {
+			case messages <- message:
+			case <-ctx.Done():
+				self.unreadMessage(message)
+				return
+			}
+		}
+	}()
+
+	return messages
+}
+
+// Err returns the error the connection was closed with, nil while it is
+// open or after a clean close
+func (self *conn) Err() error {
+	self.mutex.Lock()
+	defer self.unlock()
+	return self.err
+}
+
+// nextMessage waits for the next payload. A non-zero limit caps the data
+// returned, leaving the rest at the front of the queue.
+func (self *conn) nextMessage(ctx context.Context, limit int) ([]byte, error) {
+	stop := context.AfterFunc(ctx, func() {
+		self.mutex.Lock()
+		self.rxReady.Broadcast()
+		self.mutex.Unlock()
+	})
+	defer stop()
+
+	self.mutex.Lock()
+	defer self.unlock()
+
+	for self.rxQueue.Len() == 0 {
+		if self.state == StateClosed {
+			if self.err != nil {
+				return nil, self.err
+			}
+			return nil, io.EOF
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		self.rxReady.Wait()
+	}
+
+	front := self.rxQueue.Front()
+	data := front.Value.([]byte)
+	if limit > 0 && len(data) > limit {
+		front.Value = data[limit:]
+		return data[:limit], nil
+	}
+
+	self.rxQueue.Remove(front)
+	self.updateWindow()
+	return data, nil
+}
+
+// unreadMessage returns a payload taken by nextMessage but not delivered to
+// the front of the queue, for the next reader
+func (self *conn) unreadMessage(data []byte) {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	self.rxQueue.PushFront(data)
+	self.rxReady.Broadcast()
+}
+
+// rxWindow is the number of segments beyond the last in-order segment that
+// are accepted, shrinking as unread data queues up
+func (self *conn) rxWindow() uint16 {
+	queued := uint16(self.rxQueue.Len())
+	if queued >= self.config.MaxOutstandingSegmentsSelf {
+		return 0
+	}
+
+	return self.config.MaxOutstandingSegmentsSelf - queued
+}
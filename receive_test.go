@@ -0,0 +1,134 @@
+package psst
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMessagesIterator(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.rxLastInSeq = 0
+
+	conn.receiveSegment(&segment{SeqNumber: 2, Data: []byte{2}})
+	conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte{1}})
+	conn.receiveSegment(&segment{RST: true})
+
+	var messages []byte
+	var lastErr error
+	for message, err := range conn.Messages() {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		messages = append(messages, message...)
+	}
+
+	if string(messages) != "\x01\x02" {
+		t.Fatalf("Messages %x don't match expected", messages)
+	}
+
+	if !errors.Is(lastErr, ErrConnectionReset) {
+		t.Fatalf("Iteration ended with %v instead of connection reset", lastErr)
+	}
+}
+
+func TestReceiveWindowBackpressure(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.rxLastInSeq = 0
+
+	window := conn.config.MaxOutstandingSegmentsSelf
+	for seq := uint16(1); seq <= window+1; seq++ {
+		conn.receiveSegment(&segment{SeqNumber: seq, Data: []byte{byte(seq)}})
+	}
+
+	if conn.rxLastInSeq != window || conn.rxWindow() != 0 {
+		t.Fatalf("Receive window not closed with %d unread messages", conn.rxQueue.Len())
+	}
+
+	if message, _ := conn.ReadMessage(); message[0] != 1 {
+		t.Fatalf("Read message %x doesn't match expected", message)
+	}
+
+	conn.receiveSegment(&segment{SeqNumber: window + 1, Data: []byte{byte(window + 1)}})
+
+	if conn.rxLastInSeq != window+1 {
+		t.Fatalf("Segment not accepted after receive window opened")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.rxLastInSeq = 0
+
+	messages := conn.Subscribe(context.Background())
+
+	conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte{1}})
+	if message := <-messages; message[0] != 1 {
+		t.Fatalf("Subscribed message %x doesn't match expected", message)
+	}
+
+	conn.receiveSegment(&segment{SeqNumber: 2, Data: []byte{2}})
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+
+	if message := <-messages; message[0] != 2 {
+		t.Fatalf("Subscribed message %x doesn't match expected", message)
+	}
+
+	if _, ok := <-messages; ok || conn.Err() != nil {
+		t.Fatalf("Subscription not closed cleanly")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn = NewConn(&testTransport{})
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+
+	conn.rxLastInSeq = 0
+
+	messages = conn.Subscribe(ctx)
+	conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte{1}})
+
+	// Cancel once the subscription has taken the message off the queue, it
+	// puts the message back as nobody reads the channel
+	waitQueued(conn, 0, t)
+	cancel()
+	waitQueued(conn, 1, t)
+
+	if _, ok := <-messages; ok {
+		t.Fatalf("Subscription not closed on cancellation")
+	}
+
+	// The message it held is left for the next reader
+	if message, err := conn.ReadMessage(); err != nil || message[0] != 1 {
+		t.Fatalf("Read %x with %v after cancellation, expected the undelivered message", message, err)
+	}
+}
+
+func waitQueued(conn *conn, queued int, t *testing.T) {
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		conn.mutex.Lock()
+		n := conn.rxQueue.Len()
+		conn.mutex.Unlock()
+
+		if n == queued {
+			return
+		}
+
+		if time.Since(start) > time.Second {
+			t.Fatalf("%d messages queued, expected %d", n, queued)
+		}
+	}
+}
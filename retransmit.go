@@ -0,0 +1,210 @@
+package psst
+
+import (
+	"time"
+)
+
+// retransmissionTimeout is the current retransmission timeout, taken from
+// the local config until one has been negotiated and from the negotiated
+// config until the round trip time has been measured
+func (self *conn) retransmissionTimeout() time.Duration {
+	if self.config == nil {
+		return self.localConfig.RetransmissionTimeout
+	}
+
+	if self.rto != 0 {
+		return self.rto
+	}
+
+	return millisToDuration(self.config.RetransmissionTimeout)
+}
+
+// maxRetransmissions is the retransmission limit, zero for no limit
+func (self *conn) maxRetransmissions() uint8 {
+	if self.config == nil {
+		return self.localConfig.MaxRetransmissions
+	}
+
+	return self.config.MaxRetransmissions
+}
+
+// armRetransmissionTimer schedules the retransmission timer for the oldest
+// outstanding transmission, or stops it when nothing is outstanding
+func (self *conn) armRetransmissionTimer() {
+	if self.retransmissionTimer != nil {
+		self.retransmissionTimer.Stop()
+		self.retransmissionTimer = nil
+	}
+
+	var oldest time.Time
+	switch self.state {
+
+	case StateSynSent, StateSynReceived:
+		oldest = self.synSentAt
+
+	case StateOpen:
+		if self.txBuffer.Len() == 0 {
+			return
+		}
+
+		for element := self.txBuffer.Front(); element != nil; element = element.Next() {
+			entry := element.Value.(*txBufferEntry)
+			if !entry.paced && (oldest.IsZero() || entry.sentAt.Before(oldest)) {
+				oldest = entry.sentAt
+			}
+		}
+
+		// Entries waiting for the pacer arm the timer once sent
+		if oldest.IsZero() {
+			return
+		}
+
+	default:
+		return
+
+	}
+
+	delay := time.Until(oldest.Add(self.retransmissionTimeout()))
+	self.retransmissionTimer = time.AfterFunc(delay, self.retransmissionTimerExpired)
+}
+
+func (self *conn) retransmissionTimerExpired() {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	self.retransmit()
+}
+
+// retransmit resends every transmission outstanding for longer than the
+// retransmission timeout. Once one has been retransmitted MaxRetransmissions
+// times the connection is auto reset, or failed after MaxAutoReset
+// consecutive auto resets.
+func (self *conn) retransmit() {
+	deadline := time.Now().Add(-self.retransmissionTimeout())
+	maxRetransmissions := self.maxRetransmissions()
+	retransmitted := false
+
+	switch self.state {
+
+	case StateSynSent, StateSynReceived:
+		if self.synSentAt.After(deadline) {
+			break
+		}
+
+		if maxRetransmissions != 0 && self.synTxCount >= maxRetransmissions {
+			self.fire(eventRetransmissionLimit, nil, ErrRetransmissionLimit)
+			return
+		}
+
+		self.synTxCount++
+		self.stats.SegmentsRetransmitted++
+		self.sendSyn()
+		retransmitted = true
+
+	case StateOpen:
+		for element := self.txBuffer.Front(); element != nil; element = element.Next() {
+			entry := element.Value.(*txBufferEntry)
+			if entry.paced || entry.sentAt.After(deadline) {
+				continue
+			}
+
+			if maxRetransmissions != 0 && entry.txCount >= maxRetransmissions {
+				self.fire(eventRetransmissionLimit, nil, ErrRetransmissionLimit)
+				return
+			}
+
+			if !retransmitted {
+				self.congestion.OnTimeout(self.txBuffer.Len())
+			}
+
+			if entry.timeouts < 0xFF {
+				entry.timeouts++
+			}
+			self.retransmitEntry(entry)
+			self.pathBlackHole(entry)
+			retransmitted = true
+		}
+
+	default:
+		return
+
+	}
+
+	if retransmitted {
+		self.backoffRto()
+	}
+	self.armRetransmissionTimer()
+}
+
+func (self *conn) retransmitEntry(entry *txBufferEntry) {
+	if entry.txCount < 0xFF {
+		entry.txCount++
+	}
+	self.stats.SegmentsRetransmitted++
+	self.stats.BytesRetransmitted += uint64(len(entry.Data))
+	self.send(entry)
+}
+
+// fastRetransmitThreshold is the number of segments acknowledged with EAKs
+// above an outstanding one that show it has been lost, zero if disabled
+func (self *conn) fastRetransmitThreshold() uint8 {
+	if self.localConfig == nil {
+		return 0
+	}
+
+	return self.localConfig.FastRetransmitThreshold
+}
+
+// eakEvidence counts a segment acknowledged with an EAK against the
+// outstanding segments sent before it, and retransmits those it shows lost
+// without waiting for the retransmission timeout. A segment is fast
+// retransmitted once, should the retransmission be lost as well it is left
+// to the timeout.
+func (self *conn) eakEvidence(eak uint16) {
+	threshold := self.fastRetransmitThreshold()
+	if threshold == 0 {
+		return
+	}
+
+	maxRetransmissions := self.maxRetransmissions()
+	for element := self.txBuffer.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*txBufferEntry)
+
+		// Check for positive unsigned diff: SeqNumber >= eak
+		if diff := int16(entry.SeqNumber - eak); diff >= 0 {
+			break
+		}
+
+		if entry.eakEvidence < 0xFF {
+			entry.eakEvidence++
+		}
+
+		if entry.eakEvidence < threshold || entry.fastRetransmitted || entry.paced {
+			continue
+		}
+
+		if maxRetransmissions != 0 && entry.txCount >= maxRetransmissions {
+			continue
+		}
+
+		entry.fastRetransmitted = true
+		self.stats.FastRetransmits++
+		self.retransmitEntry(entry)
+	}
+}
+
+func (self *conn) stopTimers() {
+	for _, timer := range []*time.Timer{self.retransmissionTimer, self.cumulativeAckTimer, self.nulTimer, self.probeTimer, self.tailLossTimer} {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+
+	self.retransmissionTimer = nil
+	self.cumulativeAckTimer = nil
+	self.nulTimer = nil
+	self.probeTimer = nil
+	self.tailLossTimer = nil
+	self.stopPacer()
+	self.stopPathSearch()
+}
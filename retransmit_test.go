@@ -0,0 +1,169 @@
+package psst
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDataRetransmission(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+
+	for i := 0; i < 3; i++ {
+		conn.Write([]byte{byte(i)})
+	}
+
+	// Only the first and last segments have timed out
+	conn.txBuffer.Front().Value.(*txBufferEntry).sentAt = time.Time{}
+	conn.txBuffer.Back().Value.(*txBufferEntry).sentAt = time.Time{}
+	transport.take()
+
+	conn.retransmit()
+
+	segments := transport.take()
+	if len(segments) != 2 || segments[0].SeqNumber != conn.txNextSeq-3 || segments[1].SeqNumber != conn.txNextSeq-1 {
+		t.Fatalf("Retransmitted segments %v don't match expected", segments)
+	}
+
+	for element, txCount := conn.txBuffer.Front(), []uint8{1, 0, 1}; element != nil; element = element.Next() {
+		if entry := element.Value.(*txBufferEntry); entry.txCount != txCount[0] {
+			t.Fatalf("txBuffer entry %d retransmitted %d times, expected %d", entry.SeqNumber, entry.txCount, txCount[0])
+		}
+		txCount = txCount[1:]
+	}
+
+	if stats := conn.Stats(); stats.SegmentsRetransmitted != 2 || stats.BytesRetransmitted != 2 || stats.SegmentsSent != 5 {
+		t.Fatalf("Stats %+v don't count retransmissions", stats)
+	}
+
+	conn.closed(nil)
+}
+
+func TestRetransmissionLimit(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.MaxRetransmissions = 2
+
+	handler := &recordingHandler{}
+	conn.handler = handler
+
+	conn.Write([]byte{0})
+	entry := conn.txBuffer.Front().Value.(*txBufferEntry)
+
+	for i := 0; i < 3; i++ {
+		entry.sentAt = time.Time{}
+		conn.retransmit()
+	}
+
+	segments := transport.take()
+	if len(segments) != 4 || !segments[3].RST {
+		t.Fatalf("Sent segments %v, expected 2 retransmissions followed by RST", segments)
+	}
+
+	if conn.state != StateClosed || conn.retransmissionTimer != nil {
+		t.Fatalf("Connection in %v with retransmission timer %v after retransmission limit", conn.state, conn.retransmissionTimer)
+	}
+
+	if err := conn.Write([]byte{0}); !errors.Is(err, ErrRetransmissionLimit) {
+		t.Fatalf("Write failed with %v, expected retransmission limit", err)
+	}
+
+	validateEvents(handler, []string{
+		"state StateOpen StateClosed",
+		"close Retransmission limit exceeded",
+	}, t)
+}
+
+func TestSynRetransmission(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	config := DefaultConfig()
+	config.MaxRetransmissions = 1
+	conn.Dial(config)
+
+	conn.synSentAt = time.Time{}
+	conn.retransmit()
+
+	segments := transport.take()
+	if len(segments) != 2 || !segments[1].SYN || segments[1].SeqNumber != segments[0].SeqNumber {
+		t.Fatalf("Sent segments %v, expected SYN retransmission", segments)
+	}
+
+	conn.synSentAt = time.Time{}
+	conn.retransmit()
+
+	if conn.state != StateClosed || conn.err != ErrRetransmissionLimit {
+		t.Fatalf("Connection in %v with error %v after SYN retransmission limit", conn.state, conn.err)
+	}
+}
+
+func TestRetransmissionTimer(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.RetransmissionTimeout = 10
+
+	conn.Write([]byte{0})
+
+	for start := time.Now(); conn.Stats().SegmentsRetransmitted == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Segment not retransmitted after timeout")
+		}
+	}
+
+	conn.receiveSegment(&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1})
+
+	conn.mutex.Lock()
+	defer conn.unlock()
+
+	if conn.txBuffer.Len() != 0 || conn.retransmissionTimer != nil {
+		t.Fatalf("Retransmission timer %v still armed after ACK", conn.retransmissionTimer)
+	}
+}
+
+func TestFastRetransmit(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.localConfig = DefaultConfig()
+	conn.localConfig.FastRetransmitThreshold = 2
+	conn.config = defaultConfig()
+	conn.txNextSeq = 1
+	conn.txOldestUnacked = 0
+
+	for i := 1; i <= 5; i++ {
+		conn.Write([]byte{byte(i)})
+	}
+	transport.take()
+
+	// Segments 1 and 2 are lost, the EAK for 4 is the second piece of
+	// evidence against them
+	for _, eakNumbers := range [][]uint16{{3}, {3, 4}, {3, 4, 5}} {
+		conn.receiveSegment(&segment{ACK: true, EAK: true, SeqNumber: 1, AckNumber: 0, VarHeader: &eakVarHeader{EakNumbers: eakNumbers}})
+	}
+
+	segments := transport.take()
+	if len(segments) != 2 || segments[0].SeqNumber != 1 || segments[1].SeqNumber != 2 {
+		t.Fatalf("Retransmitted segments %v don't match expected", segments)
+	}
+
+	validateTxBuffer(conn, []uint16{1, 2}, t)
+
+	if stats := conn.Stats(); stats.FastRetransmits != 2 || stats.SegmentsRetransmitted != 2 {
+		t.Fatalf("Stats %+v don't count fast retransmissions", stats)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
@@ -0,0 +1,59 @@
+package psst
+
+import (
+	"time"
+)
+
+// Round trip time estimation and retransmission timeout computation follow
+// RFC 6298. The negotiated RetransmissionTimeout is the initial timeout, the
+// timeout then adapts between the negotiated CumulativeAckTimeout, below
+// which the peer's delayed ACKs would be retransmitted, and NulTimeout.
+
+const clockGranularity = time.Millisecond
+
+// sampleRtt updates the smoothed round trip time and its variation with a
+// new measurement and recomputes the retransmission timeout
+func (self *conn) sampleRtt(rtt time.Duration) {
+	self.lastRtt = rtt
+
+	if self.srtt == 0 {
+		self.srtt = rtt
+		self.rttvar = rtt / 2
+	} else {
+		self.rttvar = (3*self.rttvar + (self.srtt - rtt).Abs()) / 4
+		self.srtt = (7*self.srtt + rtt) / 8
+	}
+
+	self.setRto(self.srtt + max(clockGranularity, 4*self.rttvar))
+}
+
+// measureRtt samples the round trip time of an acknowledged segment. By
+// Karn's rule retransmitted segments are not sampled, as it is ambiguous
+// which transmission was acknowledged.
+func (self *conn) measureRtt(entry *txBufferEntry) {
+	if entry.txCount == 0 && !entry.probed && !entry.sentAt.IsZero() {
+		self.sampleRtt(time.Since(entry.sentAt))
+	}
+}
+
+// measureHandshakeRtt samples the round trip time of the SYN once the peer
+// has responded to it
+func (self *conn) measureHandshakeRtt() {
+	if self.synTxCount == 0 && !self.synSentAt.IsZero() {
+		self.sampleRtt(time.Since(self.synSentAt))
+	}
+}
+
+// backoffRto doubles the retransmission timeout after a retransmission,
+// until the next measurement
+func (self *conn) backoffRto() {
+	self.setRto(2 * self.retransmissionTimeout())
+}
+
+func (self *conn) setRto(rto time.Duration) {
+	if self.config == nil {
+		return
+	}
+
+	self.rto = min(max(rto, millisToDuration(self.config.CumulativeAckTimeout)), millisToDuration(self.config.NulTimeout))
+}
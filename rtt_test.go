@@ -0,0 +1,115 @@
+package psst
+
+import (
+	"testing"
+	"time"
+)
+
+func rttConn() *conn {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.localConfig = DefaultConfig()
+	conn.config = defaultConfig()
+	conn.config.CumulativeAckTimeout = 100
+	conn.config.RetransmissionTimeout = 1000
+	conn.config.NulTimeout = 10000
+	conn.txNextSeq = 1
+	conn.txOldestUnacked = 0
+
+	return conn
+}
+
+func TestRttEstimation(t *testing.T) {
+	conn := rttConn()
+
+	if rto := conn.retransmissionTimeout(); rto != time.Second {
+		t.Fatalf("Initial RTO %v doesn't match negotiated", rto)
+	}
+
+	enqueueTxSegments(conn, 2)
+	conn.txBuffer.Front().Value.(*txBufferEntry).sentAt = time.Now().Add(-time.Second)
+	conn.txBuffer.Back().Value.(*txBufferEntry).sentAt = time.Now().Add(-200 * time.Millisecond)
+
+	// Only the most recently sent of the acknowledged segments is timed
+	conn.handleSegment(&segment{ACK: true, SeqNumber: 1, AckNumber: 2})
+
+	stats := conn.Stats()
+	if stats.RTT < 200*time.Millisecond || stats.RTT > 250*time.Millisecond {
+		t.Fatalf("RTT %v doesn't match measured 200ms", stats.RTT)
+	}
+
+	// The first measurement sets the variation to half the round trip time
+	if expected := stats.RTT + 4*(stats.RTT/2); stats.RTO != expected {
+		t.Fatalf("RTO %v doesn't match expected %v", stats.RTO, expected)
+	}
+
+	// Retransmitted segments are not timed
+	enqueueTxSegments(conn, 1)
+	entry := conn.txBuffer.Front().Value.(*txBufferEntry)
+	entry.sentAt = time.Now().Add(-5 * time.Second)
+	entry.txCount = 1
+
+	conn.handleSegment(&segment{ACK: true, SeqNumber: 2, AckNumber: 3})
+
+	if rtt := conn.Stats().RTT; rtt != stats.RTT {
+		t.Fatalf("RTT %v changed by retransmitted segment", rtt)
+	}
+
+	// Nor are those resent as tail loss probes
+	enqueueTxSegments(conn, 1)
+	entry = conn.txBuffer.Front().Value.(*txBufferEntry)
+	entry.sentAt = time.Now().Add(-5 * time.Second)
+	entry.probed = true
+
+	conn.handleSegment(&segment{ACK: true, SeqNumber: 3, AckNumber: 4})
+
+	if rtt := conn.Stats().RTT; rtt != stats.RTT {
+		t.Fatalf("RTT %v changed by probed segment", rtt)
+	}
+
+	conn.closed(nil)
+}
+
+func TestRtoBounds(t *testing.T) {
+	conn := rttConn()
+
+	conn.sampleRtt(time.Millisecond)
+	if conn.rto != 100*time.Millisecond {
+		t.Fatalf("RTO %v below CumulativeAckTimeout", conn.rto)
+	}
+
+	// Each retransmission doubles the timeout up to NulTimeout
+	enqueueTxSegments(conn, 1)
+	for _, expected := range []time.Duration{200 * time.Millisecond, 400 * time.Millisecond} {
+		conn.txBuffer.Front().Value.(*txBufferEntry).sentAt = time.Time{}
+		conn.retransmit()
+
+		if conn.rto != expected {
+			t.Fatalf("RTO %v after retransmission, expected %v", conn.rto, expected)
+		}
+	}
+
+	conn.sampleRtt(time.Minute)
+	if conn.rto != 10*time.Second {
+		t.Fatalf("RTO %v above NulTimeout", conn.rto)
+	}
+
+	conn.closed(nil)
+}
+
+func TestHandshakeRtt(t *testing.T) {
+	listener := NewConn(&testTransport{})
+	listener.Listen(nil)
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(nil)
+
+	exchange(listener, dialer, t)
+
+	if listener.Stats().RTT == 0 || dialer.Stats().RTT == 0 {
+		t.Fatalf("Handshake round trip not measured")
+	}
+
+	closePair(listener, dialer)
+}
@@ -3,23 +3,27 @@ package psst
 import (
 	"encoding"
 	"encoding/binary"
+	"fmt"
+	"strings"
 )
 
 // Segment format
 //
 //  0             0 0   1         1
 //  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5
-// +-+-+-+-+-+-----+---------------+
-// |S|A|E|R|N|Reser|    Header     |
-// |Y|C|A|S|U|-ved |    Length     |
-// |N|K|K|T|L| (0) |(16-bit words) |
-// +-+-+-+-+-+-----+---------------+
+// +-+-+-+-+-+-+-+-+---------------+
+// |S|A|E|R|N|W|T|P|    Header     |
+// |Y|C|A|S|U|N|C|R|    Length     |
+// |N|K|K|T|L|D|S|B|(16-bit words) |
+// +-+-+-+-+-+-+-+-+---------------+
 // |        Sequence Number        |
 // +---------------+---------------+
 // |    Acknowledgement Number     |
 // +---------------+---------------+
 // |     Data Length (octets)      |
 // +---------------+---------------+
+// |  Receive Window (WND only)    |
+// +---------------+---------------+
 // |   Variable Header Section     |
 // .                               .
 // .                               .
@@ -32,9 +36,11 @@ import (
 // +---------------+---------------+
 
 type segment struct {
-	SYN, ACK, EAK, RST, NUL bool
-	SeqNumber               uint16
-	AckNumber               uint16
+	SYN, ACK, EAK, RST, NUL, TCS, WND, PRB bool
+	SeqNumber                              uint16
+	AckNumber                              uint16
+	// Segments beyond AckNumber the sender accepts, carried with WND
+	Window uint16
 	VarHeader
 	Data []byte
 }
@@ -52,8 +58,16 @@ func (self *segment) MarshalBinary() ([]byte, error) {
 		}
 	}
 
-	headerLength := 8 + len(mashaledVarHeader)
+	fixedLength := 8
+	if self.WND {
+		fixedLength += 2
+	}
+
+	headerLength := fixedLength + len(mashaledVarHeader)
 	dataLength := len(self.Data)
+	if headerLength > maxHeaderLength || dataLength > 0xFFFF {
+		return nil, ErrMalformedSegment
+	}
 	buffer := make([]byte, headerLength+dataLength)
 
 	// Pack variables
@@ -62,12 +76,100 @@ func (self *segment) MarshalBinary() ([]byte, error) {
 	binary.BigEndian.PutUint16(buffer[2:], self.SeqNumber)
 	binary.BigEndian.PutUint16(buffer[4:], self.AckNumber)
 	binary.BigEndian.PutUint16(buffer[6:], uint16(dataLength))
-	copy(buffer[8:], mashaledVarHeader)
+	if self.WND {
+		binary.BigEndian.PutUint16(buffer[8:], self.Window)
+	}
+	copy(buffer[fixedLength:], mashaledVarHeader)
 	copy(buffer[headerLength:], self.Data)
 
 	return buffer, nil
 }
 
+// String summarises the segment header
+func (self *segment) String() string {
+	var flags []string
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{self.SYN, "SYN"},
+		{self.ACK, "ACK"},
+		{self.EAK, "EAK"},
+		{self.RST, "RST"},
+		{self.NUL, "NUL"},
+		{self.TCS, "TCS"},
+		{self.WND, "WND"},
+		{self.PRB, "PRB"},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+
+	return fmt.Sprintf("[%s] seq %d ack %d len %d", strings.Join(flags, "|"), self.SeqNumber, self.AckNumber, len(self.Data))
+}
+
+func (self *segment) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return ErrMalformedSegment
+	}
+
+	headerLength := int(data[1]) << 1
+	dataLength := int(binary.BigEndian.Uint16(data[6:]))
+	if headerLength < 8 || len(data) != headerLength+dataLength {
+		return ErrMalformedSegment
+	}
+
+	// Unpack variables
+	self.decodeFlags(data[0])
+	self.SeqNumber = binary.BigEndian.Uint16(data[2:])
+	self.AckNumber = binary.BigEndian.Uint16(data[4:])
+
+	varHeader := data[8:headerLength]
+	if self.WND {
+		if len(varHeader) < 2 {
+			return ErrMalformedSegment
+		}
+		self.Window = binary.BigEndian.Uint16(varHeader)
+		varHeader = varHeader[2:]
+	}
+
+	switch {
+
+	case self.SYN:
+		synHeader := &synVarHeader{}
+		if err := synHeader.UnmarshalBinary(varHeader); err != nil {
+			return err
+		}
+		self.VarHeader = synHeader
+
+	case self.EAK:
+		eakHeader := &eakVarHeader{}
+		if err := eakHeader.UnmarshalBinary(varHeader); err != nil {
+			return err
+		}
+		self.VarHeader = eakHeader
+
+	case self.TCS:
+		tcsHeader := &tcsVarHeader{}
+		if err := tcsHeader.UnmarshalBinary(varHeader); err != nil {
+			return err
+		}
+		self.VarHeader = tcsHeader
+
+	case len(varHeader) > 0:
+		return ErrMalformedSegment
+
+	}
+
+	if dataLength > 0 {
+		self.Data = make([]byte, dataLength)
+		copy(self.Data, data[headerLength:])
+	}
+
+	return nil
+}
+
 func (self *segment) encodeFlags() uint8 {
 	var flags uint8
 
@@ -86,10 +188,30 @@ func (self *segment) encodeFlags() uint8 {
 	if self.NUL {
 		flags |= 1 << 3
 	}
+	if self.WND {
+		flags |= 1 << 2
+	}
+	if self.TCS {
+		flags |= 1 << 1
+	}
+	if self.PRB {
+		flags |= 1 << 0
+	}
 
 	return flags
 }
 
+func (self *segment) decodeFlags(flags uint8) {
+	self.SYN = flags&(1<<7) != 0
+	self.ACK = flags&(1<<6) != 0
+	self.EAK = flags&(1<<5) != 0
+	self.RST = flags&(1<<4) != 0
+	self.NUL = flags&(1<<3) != 0
+	self.WND = flags&(1<<2) != 0
+	self.TCS = flags&(1<<1) != 0
+	self.PRB = flags&(1<<0) != 0
+}
+
 // Variable header fields
 
 // SYN header format
@@ -154,6 +276,31 @@ func (self *synVarHeader) MarshalBinary() ([]byte, error) {
 	return buffer, nil
 }
 
+func (self *synVarHeader) UnmarshalBinary(data []byte) error {
+	if len(data) != 16 {
+		return ErrMalformedSegment
+	}
+
+	self.Version = data[0]
+	self.MaxSegmentSize = binary.BigEndian.Uint16(data[2:])
+	self.MaxOutstandingSegments = binary.BigEndian.Uint16(data[4:])
+	self.RetransmissionTimeout = binary.BigEndian.Uint16(data[6:])
+	self.CumulativeAckTimeout = binary.BigEndian.Uint16(data[8:])
+	self.NulTimeout = binary.BigEndian.Uint16(data[10:])
+	self.MaxRetransmissions = data[12]
+	self.MaxCumulativeAck = data[13]
+	self.MaxOutOfSeq = data[14]
+	self.MaxAutoReset = data[15]
+
+	return nil
+}
+
+// Header length is carried in 16-bit words in a single octet
+const maxHeaderLength = 0xFF << 1
+
+// Most EAK numbers that fit in the variable header, alongside the window
+const maxEakNumbers = (maxHeaderLength - 10) / 2
+
 type eakVarHeader struct {
 	EakNumbers []uint16
 }
@@ -167,3 +314,98 @@ func (self *eakVarHeader) MarshalBinary() ([]byte, error) {
 
 	return buffer, nil
 }
+
+func (self *eakVarHeader) UnmarshalBinary(data []byte) error {
+	if len(data)%2 != 0 {
+		return ErrMalformedSegment
+	}
+
+	self.EakNumbers = make([]uint16, len(data)/2)
+	for i := 0; i < len(self.EakNumbers); i++ {
+		self.EakNumbers[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+
+	return nil
+}
+
+// TCS header format
+//
+//  0             0 0   1         1
+//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5
+// +-+-+-+-+-+-+-+-+---------------+
+// | |A| | | | |T| |               |
+// |0|C|0|0|0|0|C|0|  18 + N / 2   |
+// | |K| | | | |S| |               |
+// +-+-+-+-+-+-+-+-+---------------+
+// |        Sequence Number        |
+// +---------------+---------------+
+// |    Acknowledgement Number     |
+// +---------------+---------------+
+// |               0               |
+// +---------------+---------------+
+// |     Connection Identifier     |
+// |                               |
+// +---------------+---------------+
+// |        Transfer Epoch         |
+// |                               |
+// +---------------+---------------+
+// |    Message Authentication     |
+// .             Code              .
+// .          (16 octets)          .
+// |                               |
+// +---------------+---------------+
+// |    Address Length (octets)    |
+// +---------------+---------------+
+// |            Address            |
+// .     (N octets, padded to      .
+// .      16-bit words)            .
+// |                               |
+// +---------------+---------------+
+
+type tcsVarHeader struct {
+	ConnID uint32
+	// Counts the transfers of the connection, so that replayed TCS segments
+	// can be told apart once the sequence numbers wrap around
+	Epoch uint32
+	MAC   [16]byte
+	// Address the sender is reached at, empty when its transport doesn't
+	// say
+	Address string
+}
+
+// Longest address of a TCS header, leaving room for the rest of the header
+const maxTransferAddress = maxHeaderLength - 10 - 26
+
+func (self *tcsVarHeader) MarshalBinary() ([]byte, error) {
+	if len(self.Address) > maxTransferAddress {
+		return nil, ErrMalformedSegment
+	}
+
+	buffer := make([]byte, 26+len(self.Address)+len(self.Address)%2)
+
+	binary.BigEndian.PutUint32(buffer, self.ConnID)
+	binary.BigEndian.PutUint32(buffer[4:], self.Epoch)
+	copy(buffer[8:], self.MAC[:])
+	binary.BigEndian.PutUint16(buffer[24:], uint16(len(self.Address)))
+	copy(buffer[26:], self.Address)
+
+	return buffer, nil
+}
+
+func (self *tcsVarHeader) UnmarshalBinary(data []byte) error {
+	if len(data) < 26 {
+		return ErrMalformedSegment
+	}
+
+	length := int(binary.BigEndian.Uint16(data[24:]))
+	if len(data) != 26+length+length%2 {
+		return ErrMalformedSegment
+	}
+
+	self.ConnID = binary.BigEndian.Uint32(data)
+	self.Epoch = binary.BigEndian.Uint32(data[4:])
+	copy(self.MAC[:], data[8:])
+	self.Address = string(data[26 : 26+length])
+
+	return nil
+}
@@ -3,6 +3,7 @@ package psst
 import (
 	"bytes"
 	"encoding/hex"
+	"reflect"
 	"testing"
 )
 
@@ -129,6 +130,79 @@ func TestEakSerialization(t *testing.T) {
 	checkSegment(segment, expected, t)
 }
 
+func TestWindowSerialization(t *testing.T) {
+	segment := segment{
+		ACK:       true,
+		EAK:       true,
+		WND:       true,
+		SeqNumber: 0x1234,
+		AckNumber: 0x5678,
+		Window:    0x0010,
+		VarHeader: &eakVarHeader{
+			EakNumbers: []uint16{0x123a},
+		},
+	}
+
+	expected := []byte{
+		0x64, 0x06,
+		0x12, 0x34,
+		0x56, 0x78,
+		0x00, 0x00,
+		0x00, 0x10,
+		0x12, 0x3a,
+	}
+
+	checkSegment(segment, expected, t)
+}
+
+func TestDeserialization(t *testing.T) {
+	input := []*segment{
+		{ACK: true, SeqNumber: 0x1234, AckNumber: 0x5678},
+		{ACK: true, NUL: true, SeqNumber: 0x1234, AckNumber: 0x5678},
+		{RST: true, SeqNumber: 0x1234},
+		{ACK: true, SeqNumber: 0x1234, AckNumber: 0x5678, Data: []byte{0xba, 0xad, 0xbe, 0xef, 0x15}},
+		{SYN: true, ACK: true, SeqNumber: 0x1234, AckNumber: 0x5678, VarHeader: DefaultConfig().synHeader()},
+		{ACK: true, EAK: true, SeqNumber: 0x1234, AckNumber: 0x5678, VarHeader: &eakVarHeader{EakNumbers: []uint16{0x123a, 0x123c}}, Data: []byte{0xba}},
+		{ACK: true, TCS: true, SeqNumber: 0x1234, AckNumber: 0x5678, VarHeader: &tcsVarHeader{ConnID: 0x12345678, Epoch: 2, MAC: [16]byte{0xba, 0xad}, Address: "odd"}},
+		{ACK: true, WND: true, SeqNumber: 0x1234, AckNumber: 0x5678, Window: 8, Data: []byte{0xba}},
+		{ACK: true, NUL: true, PRB: true, WND: true, SeqNumber: 0x1234, AckNumber: 0x5678, Window: 8, Data: make([]byte, 16)},
+	}
+
+	for _, seg := range input {
+		serialized, err := seg.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Failed to serialze segment: %v", err)
+		}
+
+		deserialized := &segment{}
+		if err := deserialized.UnmarshalBinary(serialized); err != nil {
+			t.Fatalf("Failed to deserialize segment: %v", err)
+		}
+
+		if !reflect.DeepEqual(deserialized, seg) {
+			t.Fatalf("Deserialized segment %v didn't match expected %v", deserialized, seg)
+		}
+	}
+}
+
+func TestMalformedDeserialization(t *testing.T) {
+	input := [][]byte{
+		{0x40, 0x04, 0x12, 0x34, 0x56},
+		{0x40, 0x03, 0x12, 0x34, 0x56, 0x78, 0x00, 0x00},
+		{0x40, 0x04, 0x12, 0x34, 0x56, 0x78, 0x00, 0x02, 0xba},
+		{0x40, 0x05, 0x12, 0x34, 0x56, 0x78, 0x00, 0x00, 0x12, 0x3a},
+		{0x80, 0x04, 0x12, 0x34, 0x56, 0x78, 0x00, 0x00},
+		{0x42, 0x06, 0x12, 0x34, 0x56, 0x78, 0x00, 0x00, 0x12, 0x34, 0x56, 0x78},
+	}
+
+	for _, data := range input {
+		segment := segment{}
+		if err := segment.UnmarshalBinary(data); err != ErrMalformedSegment {
+			t.Fatalf("Malformed segment deserialized without error: %v", hex.Dump(data))
+		}
+	}
+}
+
 func checkSegment(seg segment, expected []byte, t *testing.T) {
 	serialized, err := seg.MarshalBinary()
 
@@ -0,0 +1,153 @@
+package psst
+
+import (
+	"time"
+)
+
+// Write sends data to the peer as a single segment, it must not exceed the
+// negotiated maximum segment size, Stream splits larger data. Unlike
+// Stream's segments the message is not kept to the payload size found by
+// path discovery. Data is buffered until acknowledged and retransmitted as
+// needed.
+//
+// Once the peer's window of MaxOutstandingSegments, the receive window it
+// advertises or the congestion window is full, or while the connection is
+// being auto reset, Write blocks until there is room again. In non-blocking
+// mode it returns ErrWouldBlock instead, and the handler's OnWritable is
+// called once there is room.
+func (self *conn) Write(data []byte) error {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	// A message too large is refused before waiting for room. The size is
+	// known once the handshake has negotiated it.
+	if self.config != nil && len(data) > int(self.config.MaxSegmentSize) {
+		return ErrSegmentTooLarge
+	}
+
+	// Stream data written before the message goes first
+	if err := self.flushPending(); err != nil {
+		return err
+	}
+
+	if err := self.waitWritable(); err != nil {
+		return err
+	}
+
+	// An auto reset while waiting may have negotiated a smaller size
+	if len(data) > int(self.config.MaxSegmentSize) {
+		return ErrSegmentTooLarge
+	}
+
+	self.transmit(&txBufferEntry{
+		Data: append([]byte(nil), data...),
+	})
+
+	return nil
+}
+
+// waitWritable waits until a segment can be sent, or returns ErrWouldBlock
+// in non-blocking mode
+func (self *conn) waitWritable() error {
+	for !self.writable() {
+		if err := self.openErr(); err != nil {
+			return err
+		}
+
+		self.writeBlocked = true
+		self.armProbeTimer()
+		if self.nonBlocking {
+			return ErrWouldBlock
+		}
+
+		self.txReady.Wait()
+	}
+
+	return nil
+}
+
+// Writable reports whether Write can send without blocking
+func (self *conn) Writable() bool {
+	self.mutex.Lock()
+	defer self.unlock()
+	return self.writable()
+}
+
+// SetNonBlocking makes Write return ErrWouldBlock rather than block while
+// the window is full
+func (self *conn) SetNonBlocking(nonBlocking bool) {
+	self.mutex.Lock()
+	defer self.unlock()
+	self.nonBlocking = nonBlocking
+}
+
+func (self *conn) writable() bool {
+	// The config is negotiated by the time the connection is open
+	if self.state != StateOpen {
+		return false
+	}
+
+	window := min(int(self.config.MaxOutstandingSegmentsPeer), self.congestionWindow())
+	return self.txBuffer.Len() < window && self.txWindowRoom()
+}
+
+// openErr is the error writes fail with unless the connection is open or
+// being auto reset
+func (self *conn) openErr() error {
+	if self.state == StateOpen || self.resynchronising() {
+		return nil
+	}
+
+	if self.err != nil {
+		return self.err
+	}
+	return ErrNotOpen
+}
+
+// resynchronising reports whether an auto reset is in progress
+func (self *conn) resynchronising() bool {
+	return (self.state == StateSynSent || self.state == StateSynReceived) && self.config != nil
+}
+
+// wakeWriters wakes blocked writers when the window opens or the connection
+// state changes, and tells the handler once a refused write can be retried
+func (self *conn) wakeWriters() {
+	self.txReady.Broadcast()
+
+	if self.writeBlocked && self.writable() {
+		self.writeBlocked = false
+		self.notify(func(handler Handler) { handler.OnWritable() })
+	}
+}
+
+// transmit assigns the next sequence number to a tx buffer entry and sends
+// it, keeping it buffered until acknowledged
+func (self *conn) transmit(entry *txBufferEntry) {
+	entry.SeqNumber = self.txNextSeq
+	self.txBuffer.PushBack(entry)
+	self.txNextSeq++
+	self.send(entry)
+}
+
+// sendData transmits a tx buffer entry, acknowledging received data with it
+func (self *conn) sendData(entry *txBufferEntry) {
+	entry.sentAt = time.Now()
+	self.congestion.OnSend(self.txBuffer.Len())
+
+	segment := &segment{
+		NUL:       entry.nul,
+		TCS:       entry.tcs,
+		ACK:       true,
+		SeqNumber: entry.SeqNumber,
+		AckNumber: self.rxLastInSeq,
+		Data:      entry.Data,
+	}
+
+	// The TCS header takes the place of any EAKs
+	if entry.tcs {
+		segment.VarHeader = self.tcsHeader(entry.SeqNumber)
+	} else {
+		self.attachEaks(segment)
+	}
+	self.sendSegment(segment)
+}
@@ -0,0 +1,106 @@
+package psst
+
+import (
+	"testing"
+	"time"
+)
+
+func windowConn() *conn {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.MaxOutstandingSegmentsPeer = 2
+	conn.txNextSeq = 1
+	conn.txOldestUnacked = 0
+
+	return conn
+}
+
+func TestNonBlockingWrite(t *testing.T) {
+	conn := windowConn()
+	handler := &recordingHandler{}
+	conn.SetHandler(handler)
+	conn.SetNonBlocking(true)
+
+	for i := 0; i < 2; i++ {
+		if err := conn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("Write %d failed with %v", i, err)
+		}
+	}
+
+	// A message too large fails right away rather than waiting for room
+	if err := conn.Write(make([]byte, 1025)); err != ErrSegmentTooLarge || conn.writeBlocked {
+		t.Fatalf("Oversize write failed with %v with the peer's window full, expected too large", err)
+	}
+
+	if err := conn.Write([]byte{2}); err != ErrWouldBlock || conn.Writable() {
+		t.Fatalf("Write failed with %v with the peer's window full, expected would block", err)
+	}
+
+	validateTxBuffer(conn, []uint16{1, 2}, t)
+
+	conn.receiveSegment(&segment{ACK: true, SeqNumber: 1, AckNumber: 1})
+
+	validateEvents(handler, []string{"ack 1", "writable"}, t)
+
+	if err := conn.Write([]byte{2}); err != nil {
+		t.Fatalf("Write failed with %v once the window opened", err)
+	}
+
+	validateTxBuffer(conn, []uint16{2, 3}, t)
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
+
+func TestBlockingWrite(t *testing.T) {
+	conn := windowConn()
+
+	conn.Write([]byte{0})
+	conn.Write([]byte{1})
+
+	written := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() { written <- conn.Write([]byte{2}) }()
+	}
+
+	select {
+	case err := <-written:
+		t.Fatalf("Write returned %v with the peer's window full", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// An EAK frees room for one of the writers
+	conn.receiveSegment(&segment{ACK: true, EAK: true, SeqNumber: 1, AckNumber: 0, VarHeader: &eakVarHeader{EakNumbers: []uint16{2}}})
+
+	if err := <-written; err != nil {
+		t.Fatalf("Write failed with %v once the window opened", err)
+	}
+
+	conn.receiveSegment(&segment{RST: true})
+
+	if err := <-written; err != ErrConnectionReset {
+		t.Fatalf("Blocked write failed with %v on reset, expected connection reset", err)
+	}
+}
+
+func TestWriteBeforeOpen(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	if err := conn.Write([]byte{0}); err != ErrNotOpen || conn.Writable() {
+		t.Fatalf("Write failed with %v on a new conn, expected not open", err)
+	}
+
+	// The config isn't negotiated until the handshake completes
+	conn.Dial(nil)
+
+	if err := conn.Write([]byte{0}); err != ErrNotOpen || conn.Writable() {
+		t.Fatalf("Write failed with %v while dialling, expected not open", err)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
@@ -1,38 +1,41 @@
 package psst
 
-//go:generate stringer -type=connState
-//go:generate stringer -type=action
+//go:generate stringer -type=State
+//go:generate stringer -type=Action
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
-	"math/rand"
+	"sync"
 	"time"
 )
 
-// Connection states
-type connState int
+// State is the connection state
+type State int
 
 const (
-	stateClosed connState = iota
-	stateListen
-	stateSynSent
-	stateSynReceived
-	stateOpen
-	stateCloseWait
+	StateClosed State = iota
+	StateListen
+	StateSynSent
+	StateSynReceived
+	StateOpen
+	StateCloseWait
 )
 
-// Response action
-type action int
+// Action is the response to a received segment
+type Action int
 
 const (
-	actionContinue action = iota
-	actionDiscard
-	actionReset
-	actionAck
+	ActionContinue Action = iota
+	ActionDiscard
+	ActionReset
+	ActionAck
 )
 
+// Negotiated connection config, timeouts in milliseconds
 type connConfig struct {
+	MaxSegmentSize             uint16
 	MaxOutstandingSegmentsSelf uint16
 	MaxOutstandingSegmentsPeer uint16
 	RetransmissionTimeout      uint16
@@ -41,12 +44,28 @@ type connConfig struct {
 	MaxRetransmissions         uint8
 	MaxCumulativeAck           uint8
 	MaxOutOfSeq                uint8
+	MaxAutoReset               uint8
 }
 
 type txBufferEntry struct {
 	SeqNumber uint16
 	txCount   uint8
-	Data      []byte
+	sentAt    time.Time
+	nul       bool
+	tcs       bool
+	// Waiting for the pacer
+	paced bool
+	// Segments sent after this one acknowledged with EAKs, and whether it
+	// has been fast retransmitted on their evidence
+	eakEvidence       uint8
+	fastRetransmitted bool
+	// Retransmissions on the retransmission timeout alone, which unlike fast
+	// retransmissions and probes show the segment isn't getting through
+	timeouts uint8
+	// Resent as a tail loss probe, which isn't charged against the
+	// retransmission limit but makes its round trip time ambiguous
+	probed bool
+	Data   []byte
 }
 
 type rxBufferEntry struct {
@@ -55,254 +74,492 @@ type rxBufferEntry struct {
 }
 
 type conn struct {
-	state connState
-	// Connection config
-	config *connConfig
+	mutex sync.Mutex
+	state State
+	// Set for the conn that dialed, which sends the keepalives
+	client bool
+	// Identifies the connection in TCS segments, from both initial
+	// sequence numbers
+	id uint32
+	// Epochs of the last transfer sent and accepted
+	txTransferEpoch uint32
+	rxTransferEpoch uint32
+	// Transport to the peer
+	transport Transport
+	// Connection config, as offered locally and as negotiated with the peer
+	localConfig *Config
+	config      *connConfig
 	// Transmitter state variables
 	txNextSeq       uint16
 	txOldestUnacked uint16
 	txBuffer        *list.List
+	lastSent        time.Time
+	// Smoothed round trip time, its variation and the retransmission
+	// timeout computed from them, zero until measured
+	srtt   time.Duration
+	rttvar time.Duration
+	rto    time.Duration
+	// Latest round trip time sample
+	lastRtt time.Duration
+	// Limits the segments in flight to what the path can carry
+	congestion CongestionController
+	// Last sequence number within the receive window advertised by the
+	// peer, and the number of consecutive probes while it is closed
+	txWindowEdge       uint16
+	txWindowAdvertised bool
+	probes             uint8
+	// Path payload size discovery
+	path pathSearch
+	// Stream data held back to coalesce small writes
+	txPending []byte
+	// Entries waiting for the pacer and the time the next one is due
+	paceQueue *list.List
+	nextSend  time.Time
+	// Handshake transmitter state
+	synSentAt  time.Time
+	synTxCount uint8
+	// Initial sequence numbers of the handshake and of the sequence since
+	// the last auto reset, locally and from the peer, which a resynchronising
+	// SYN must not repeat
+	txInitialSeq, txSequenceStart uint16
+	rxInitialSeq, rxSequenceStart uint16
 	// Receiver state variables
-	rxLastInSeq uint16
-	rxBuffer    *list.List
+	rxLastInSeq  uint16
+	rxBuffer     *list.List
+	lastReceived time.Time
+	// Set while the receive window last advertised is closed
+	rxWindowClosed bool
+	// In-order data not yet read by the application
+	rxQueue *list.List
+	rxReady *sync.Cond
+	// Writers waiting for room in the peer's window
+	txReady      *sync.Cond
+	writeBlocked bool
+	nonBlocking  bool
+	// Received segments not yet acknowledged
+	rxUnacked uint16
 	// Timers
 	retransmissionTimer *time.Timer
 	cumulativeAckTimer  *time.Timer
 	nulTimer            *time.Timer
+	paceTimer           *time.Timer
+	probeTimer          *time.Timer
+	tailLossTimer       *time.Timer
+	// A tail loss probe has been sent since the last ACK making progress
+	tailProbed bool
+	// Consecutive auto resets without progress
+	autoResets uint8
+	// Identifier and sequence numbers of the previous connection, while in
+	// its quiet period, and of all connections closed on the conn when the
+	// transport doesn't identify the peer
+	quiet         *quietPeriod
+	closedPeriods []*quietPeriod
+	// Error the connection was closed with
+	err error
+	// Statistics counters
+	stats Stats
+	// Event handler
+	handler     Handler
+	events      []func(Handler)
+	dispatching bool
 }
 
-func NewConn() *conn {
-	initialSeqNumber := uint16(rand.Int())
-	return &conn{
-		state:           stateClosed,
-		txNextSeq:       initialSeqNumber + 1,
-		txOldestUnacked: initialSeqNumber,
-		txBuffer:        list.New(),
-		rxBuffer:        list.New(),
+func NewConn(transport Transport) *conn {
+	conn := &conn{
+		state:     StateClosed,
+		transport: transport,
+		txBuffer:  list.New(),
+		rxBuffer:  list.New(),
+		rxQueue:   list.New(),
+		paceQueue: list.New(),
 	}
+	initialSeqNumber := conn.initialSeqNumber()
+	conn.txNextSeq = initialSeqNumber + 1
+	conn.txOldestUnacked = initialSeqNumber
+	conn.rxReady = sync.NewCond(&conn.mutex)
+	conn.txReady = sync.NewCond(&conn.mutex)
+	conn.resetCongestion()
+	return conn
 }
 
-func (self *conn) handleSegment(segment *segment) error {
-	if action, err := self.validateSegment(segment); action != actionContinue {
-		// TODO perform action
+// Listen prepares the conn to accept a connection from its peer. A nil
+// config uses DefaultConfig.
+func (self *conn) Listen(config *Config) error {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	if err := self.open(config); err != nil {
 		return err
 	}
 
-	switch self.state {
+	return self.fire(eventListen, nil, nil)
+}
 
-	case stateSynSent:
-		if segment.RST {
-			self.closed()
-			break
-		}
-		fallthrough
+// Dial opens a connection to the peer. A nil config uses DefaultConfig.
+func (self *conn) Dial(config *Config) error {
+	self.mutex.Lock()
+	defer self.unlock()
 
-	case stateListen:
-		synHeader := segment.VarHeader.(*synVarHeader)
-		if err := self.handshakeConfig(synHeader); err != nil {
-			// TODO Respond with RST
-			return err
-		}
+	if err := self.open(config); err != nil {
+		return err
+	}
 
-		if segment.ACK {
-			// TODO Respond with ACK
-			self.connected()
-		} else {
-			// TODO Respond with SYN ACK
-			self.state = stateSynReceived
-		}
+	return self.fire(eventDial, nil, nil)
+}
 
-	case stateSynReceived:
-		if segment.RST {
-			self.closed()
-			break
-		}
+func (self *conn) open(config *Config) error {
+	if config == nil {
+		config = DefaultConfig()
+	}
 
-		self.connected()
-		fallthrough
+	if err := config.Validate(); err != nil {
+		return err
+	}
 
-	case stateOpen:
-		// Handle RST & break
-		if segment.RST {
-			// TODO transition to stateCloseWait
-			self.closed()
-			break
-		}
+	if self.state != StateClosed {
+		return ErrConnectionInUse
+	}
 
-		// Handle NUL & break
-		if segment.NUL {
-			// TODO validate SeqNumber and respond with ACK
-			break
-		}
+	localConfig := *config
+	localConfig.TransferKey = append([]byte(nil), config.TransferKey...)
+	self.localConfig = &localConfig
+
+	// Start afresh when the conn is reused, clear of any previous connection
+	initialSeqNumber := self.initialSeqNumber()
+	self.txNextSeq = initialSeqNumber + 1
+	self.txOldestUnacked = initialSeqNumber
+	self.txInitialSeq = initialSeqNumber
+	self.txSequenceStart = initialSeqNumber
+	self.txBuffer.Init()
+	self.rxBuffer.Init()
+	self.rxUnacked = 0
+	self.synTxCount = 0
+	self.autoResets = 0
+	self.client = false
+	self.config = nil
+	self.id = 0
+	self.txTransferEpoch = 0
+	self.rxTransferEpoch = 0
+	self.err = nil
+	self.txWindowAdvertised = false
+	self.probes = 0
+	self.tailProbed = false
+	self.txPending = nil
+	self.path = pathSearch{}
+	self.resetCongestion()
 
-		// Handle ACK
-		if segment.ACK {
-			// Check for positive unsigned diff AckNumber > txOldestUnacked
-			if diff := int16(segment.AckNumber - self.txOldestUnacked); diff > 0 {
-				self.txOldestUnacked = segment.AckNumber
-				self.clearAckedTxBuffer()
-			}
+	return nil
+}
+
+// receiveSegment processes an incoming segment and delivers any resulting
+// handler events
+func (self *conn) receiveSegment(segment *segment) error {
+	self.mutex.Lock()
+	defer self.unlock()
+	return self.handleSegment(segment)
+}
+
+func (self *conn) handleSegment(segment *segment) error {
+	self.countReceived(segment)
+
+	if action, err := self.validateSegment(segment); action != ActionContinue {
+		self.countValidationFailure(action, segment)
+		self.performAction(action, err)
+		return err
+	}
+
+	// Only segments passing validation show the peer is alive
+	self.lastReceived = time.Now()
+
+	return self.fire(segmentEvent(segment), segment, nil)
+}
+
+// processSegment handles the acknowledgements and payload of a segment
+// received while the connection is open
+func (self *conn) processSegment(segment *segment) {
+	outstanding := self.txBuffer.Len()
+	windowRoom := self.txWindowRoom()
+
+	// Handle ACK
+	if segment.ACK {
+		// Check for positive unsigned diff AckNumber > txOldestUnacked
+		if diff := int16(segment.AckNumber - self.txOldestUnacked); diff > 0 {
+			self.txOldestUnacked = segment.AckNumber
+			self.autoResets = 0
+			self.clearAckedTxBuffer()
 		}
 
-		// Handle EAK
-		if segment.EAK {
-			eakHeader := segment.VarHeader.(*eakVarHeader)
-			for _, eak := range eakHeader.EakNumbers {
-				self.removeFromTxBuffer(eak)
+		self.receivedWindow(segment)
+	}
+
+	// Handle EAK
+	if segment.EAK {
+		eakHeader := segment.VarHeader.(*eakVarHeader)
+		for _, eak := range eakHeader.EakNumbers {
+			if self.removeFromTxBuffer(eak) {
+				self.eakEvidence(eak)
 			}
 		}
+	}
 
-		// Handle data payload
-		if len(segment.Data) > 0 {
-			if segment.SeqNumber-self.rxLastInSeq == 1 {
+	if acked := outstanding - self.txBuffer.Len(); acked > 0 {
+		self.congestion.OnAck(acked, self.lastRtt)
+		self.tailProbed = false
+	}
+
+	if segment.EAK {
+		self.detectLoss(segment.VarHeader.(*eakVarHeader).EakNumbers)
+	}
+
+	if segment.ACK {
+		self.armRetransmissionTimer()
+		self.armTailLossProbe()
+	}
+
+	if self.txBuffer.Len() < outstanding || !windowRoom && self.txWindowRoom() {
+		self.sendCoalesced()
+		self.wakeWriters()
+	}
+	self.armProbeTimer()
+
+	if segment.TCS {
+		self.receivedTransfer(segment)
+	}
+
+	// Path probes take no sequence number and their data is padding
+	if segment.PRB {
+		self.receivedPathProbe(segment)
+		return
+	}
+
+	// Handle data payload, NUL keepalives and TCS segments, dropping data
+	// beyond the receive window until the application catches up
+	if segment.NUL || segment.TCS || len(segment.Data) > 0 && segment.SeqNumber-self.rxLastInSeq <= self.rxWindow() {
+		if segment.SeqNumber-self.rxLastInSeq == 1 {
+			if len(segment.Data) > 0 {
 				self.receivedData(segment.Data)
-				self.rxLastInSeq++
-				self.flushInSeqRxBuffer()
-			} else {
-				self.bufferRxData(segment.SeqNumber, segment.Data)
 			}
-		}
+			self.rxLastInSeq++
+			self.flushInSeqRxBuffer()
 
-	case stateCloseWait:
-		if segment.RST {
-			self.closed()
-			break
+			// Keepalives and transfers are answered right away
+			if segment.NUL || segment.TCS {
+				self.sendAck()
+			} else {
+				self.scheduleAck()
+			}
+		} else {
+			// Report the gap to the sender right away
+			self.bufferRxData(segment.SeqNumber, segment.Data)
+			self.sendAck()
 		}
-
 	}
-
-	return nil
 }
 
-func (self *conn) validateSegment(segment *segment) (action, error) {
+func (self *conn) validateSegment(segment *segment) (Action, error) {
 	// Check for unexpected segment header
 	switch self.state {
 
-	case stateClosed:
-		return actionDiscard, fmt.Errorf("Unexpected segment")
+	case StateClosed:
+		// Answer segments from the peer that is still using the previous
+		// connection
+		if quiet := self.quietPeriod(); quiet != nil && !segment.RST && quiet.stale(segment) {
+			return self.reject(ActionReset, ErrStaleSegment, segment)
+		}
+
+		return self.reject(ActionDiscard, ErrUnexpectedSegment, segment)
 
-	case stateListen:
-		if !segment.SYN || segment.ACK || segment.EAK || segment.RST || segment.NUL {
-			return actionDiscard, fmt.Errorf("Invalid segment flags")
+	case StateListen:
+		if !segment.SYN || segment.ACK || segment.EAK || segment.RST || segment.NUL || segment.TCS {
+			return self.reject(ActionDiscard, ErrInvalidFlags, segment)
 		}
 
 		// Not sure if this is needed if already checked during deserialisation
 		if _, ok := segment.VarHeader.(*synVarHeader); !ok {
-			return actionReset, fmt.Errorf("SYN segment missing header")
+			return self.reject(ActionReset, ErrMissingSynHeader, segment)
+		}
+
+		if self.staleHandshake(segment) {
+			return self.reject(ActionDiscard, ErrStaleSegment, segment)
 		}
 
-	case stateSynSent:
+	case StateSynSent:
 		if segment.RST {
 			break
 		}
 
-		if !(segment.SYN && !segment.EAK && !segment.NUL) {
-			return actionDiscard, fmt.Errorf("Invalid segment flags")
+		if !(segment.SYN && !segment.EAK && !segment.NUL && !segment.TCS) {
+			return self.reject(ActionDiscard, ErrInvalidFlags, segment)
 		}
 
 		// Not sure if this is needed if already checked during deserialisation
 		if _, ok := segment.VarHeader.(*synVarHeader); !ok {
-			return actionReset, fmt.Errorf("SYN segment missing header")
+			return self.reject(ActionReset, ErrMissingSynHeader, segment)
+		}
+
+		if self.config == nil && self.staleHandshake(segment) {
+			return self.reject(ActionDiscard, ErrStaleSegment, segment)
 		}
 
 		if segment.ACK && segment.AckNumber != self.txNextSeq-1 {
-			return actionReset, fmt.Errorf("Inital ACK does not match initial sequence number")
+			return self.reject(ActionReset, ErrInitialAckMismatch, segment)
+		}
+
+		// The dialer waits for the SYN ACK when both sides auto reset at once
+		if !segment.ACK && self.client && self.config != nil {
+			return self.reject(ActionDiscard, ErrInvalidFlags, segment)
 		}
 
-	case stateSynReceived:
+	case StateSynReceived:
 		if segment.RST {
 			break
 		}
 
-		if segment.SYN || segment.EAK {
-			return actionReset, fmt.Errorf("Invalid segment flags")
+		if segment.SYN || segment.EAK || segment.TCS {
+			return self.reject(ActionReset, ErrInvalidFlags, segment)
 		}
 
 		// Check sequence number is in valid range
 		if diff := int16(segment.SeqNumber - self.rxLastInSeq); diff <= 0 || diff > int16(2*self.config.MaxOutstandingSegmentsSelf) {
-			return actionAck, fmt.Errorf("Unexpected sequence number")
+			return self.reject(ActionAck, ErrUnexpectedSeqNumber, segment)
 		}
 
 		if segment.SYN || segment.EAK {
-			return actionReset, fmt.Errorf("Invalid segment flags")
+			return self.reject(ActionReset, ErrInvalidFlags, segment)
 		}
 
 		if !segment.ACK {
-			return actionDiscard, fmt.Errorf("Need ACK for initial SYN before proceeding")
+			return self.reject(ActionDiscard, ErrInitialAckMissing, segment)
 		}
 
 		if segment.AckNumber != self.txNextSeq-1 {
-			return actionReset, fmt.Errorf("Inital ACK does not match initial sequence number")
+			return self.reject(ActionReset, ErrInitialAckMismatch, segment)
 		}
 
-	case stateOpen:
+		if len(segment.Data) > int(self.config.MaxSegmentSize) {
+			return self.reject(ActionDiscard, ErrOversizeSegment, segment)
+		}
+
+	case StateOpen:
 		if segment.RST {
 			break
 		}
 
+		// A SYN from the peer auto resetting the connection starts a new
+		// sequence
+		if self.resyncSyn(segment) {
+			break
+		}
+
 		// Check sequence number is in valid range
 		// Do this before checking other data to gracefully handle late or duplicate segments
 		if diff := int16(segment.SeqNumber - self.rxLastInSeq); diff <= 0 || diff > int16(2*self.config.MaxOutstandingSegmentsSelf) {
-			return actionAck, fmt.Errorf("Unexpected sequence number")
+			return self.reject(ActionAck, ErrUnexpectedSeqNumber, segment)
 		}
 
 		if segment.SYN {
-			return actionReset, fmt.Errorf("Invalid segment flags")
+			return self.reject(ActionReset, ErrInvalidFlags, segment)
+		}
+
+		if segment.NUL && !segment.PRB && len(segment.Data) > 0 {
+			return self.reject(ActionDiscard, ErrNulWithData, segment)
+		}
+
+		// Path probes are padded NULs, answered with the size echoed as data
+		if segment.PRB && (!segment.ACK || segment.EAK || segment.TCS || !segment.NUL && len(segment.Data) != 2) {
+			return self.reject(ActionDiscard, ErrInvalidFlags, segment)
+		}
+
+		if len(segment.Data) > int(self.config.MaxSegmentSize) {
+			return self.reject(ActionDiscard, ErrOversizeSegment, segment)
 		}
 
-		if segment.NUL && len(segment.Data) > 0 {
-			return actionDiscard, fmt.Errorf("NUL segment must not contain data payload")
+		if segment.TCS {
+			if segment.EAK || segment.NUL || len(segment.Data) > 0 {
+				return self.reject(ActionDiscard, ErrInvalidFlags, segment)
+			}
+
+			if !self.authenticTransfer(segment) {
+				return self.reject(ActionDiscard, ErrInvalidTransfer, segment)
+			}
 		}
 
 		if segment.ACK {
 			if diff := int16(segment.AckNumber - self.txNextSeq); diff >= 0 {
-				return actionDiscard, fmt.Errorf("ACK received for unsent sequence number")
+				return self.reject(ActionDiscard, ErrAckUnsent, segment)
 			}
 		}
 
 		if segment.EAK {
 			if !segment.ACK {
-				return actionDiscard, fmt.Errorf("Invalid segment flags")
+				return self.reject(ActionDiscard, ErrInvalidFlags, segment)
 			}
 
 			eakHeader, ok := segment.VarHeader.(*eakVarHeader)
 			if !ok || len(eakHeader.EakNumbers) == 0 {
-				return actionReset, fmt.Errorf("EAK segment missing header")
+				return self.reject(ActionReset, ErrMissingEakHeader, segment)
 			}
 
 			for _, eak := range eakHeader.EakNumbers {
 				if diff := int16(eak - segment.AckNumber); diff < 0 {
-					return actionDiscard, fmt.Errorf("EAK number smaller than segment ACK number")
+					return self.reject(ActionDiscard, ErrEakBelowAck, segment)
 				}
 				if diff := int16(eak - self.txNextSeq); diff >= 0 {
-					return actionDiscard, fmt.Errorf("EAK received for unsent sequence number")
+					return self.reject(ActionDiscard, ErrEakUnsent, segment)
 				}
 			}
 		}
 
-	case stateCloseWait:
+	case StateCloseWait:
 		if !segment.RST {
-			return actionDiscard, fmt.Errorf("Unexpected segment")
+			return self.reject(ActionDiscard, ErrUnexpectedSegment, segment)
 		}
 
 	}
 
-	return actionContinue, nil
+	return ActionContinue, nil
 }
 
-func (self *conn) handshakeConfig(synHeader *synVarHeader) error {
-	// TODO Validate config is compatible/agreeable
-	// TODO Init connection config
-	return nil
+func (self *conn) performAction(action Action, err error) {
+	switch action {
+
+	case ActionAck:
+		// Repeat the SYN ACK until the handshake completes
+		if self.state == StateSynReceived {
+			self.sendSyn()
+			break
+		}
+		self.sendAck()
+
+	case ActionReset:
+		self.fire(eventReset, nil, err)
+
+	}
+}
+
+// handshakeConfig negotiates the connection config from the peer's SYN,
+// which is a reply to the local SYN when it has the ACK flag set
+func (self *conn) handshakeConfig(segment *segment) (*connConfig, error) {
+	policy := self.localConfig.Negotiation
+	if segment.ACK && policy != NegotiateReject {
+		policy = NegotiateAccept
+	}
+
+	return negotiateConfig(self.localConfig, segment.VarHeader.(*synVarHeader), policy)
 }
 
-func (self *conn) removeFromTxBuffer(seqNumber uint16) {
+// removeFromTxBuffer removes an entry acknowledged with an EAK, reporting
+// whether it was outstanding
+func (self *conn) removeFromTxBuffer(seqNumber uint16) bool {
 	for element := self.txBuffer.Front(); element != nil; element = element.Next() {
 		entry := element.Value.(*txBufferEntry)
 
 		if entry.SeqNumber == seqNumber {
 			self.txBuffer.Remove(element)
-			break
+			entry.paced = false
+			self.measureRtt(entry)
+			self.notify(func(handler Handler) { handler.OnAck(seqNumber) })
+			return true
 		}
 
 		// Check for positive unsigned diff: buffer SeqNumber > input seqNumber
@@ -310,9 +567,15 @@ func (self *conn) removeFromTxBuffer(seqNumber uint16) {
 			break
 		}
 	}
+
+	return false
 }
 
 func (self *conn) clearAckedTxBuffer() {
+	// Only the most recently sent segment is timed, the ACK for earlier ones
+	// may have been delayed
+	var newest *txBufferEntry
+
 	var next *list.Element
 	for element := self.txBuffer.Front(); element != nil; element = next {
 		entry := element.Value.(*txBufferEntry)
@@ -324,11 +587,24 @@ func (self *conn) clearAckedTxBuffer() {
 
 		next = element.Next()
 		self.txBuffer.Remove(element)
+		entry.paced = false
+		self.notify(func(handler Handler) { handler.OnAck(entry.SeqNumber) })
+		newest = entry
+	}
+
+	if newest != nil {
+		self.measureRtt(newest)
 	}
 }
 
 func (self *conn) receivedData(data []byte) {
-	// TODO Forward new data to listener
+	if self.handler != nil {
+		self.notify(func(handler Handler) { handler.OnData(data) })
+		return
+	}
+
+	self.rxQueue.PushBack(data)
+	self.rxReady.Broadcast()
 }
 
 func (self *conn) flushInSeqRxBuffer() {
@@ -342,7 +618,9 @@ func (self *conn) flushInSeqRxBuffer() {
 
 		next = element.Next()
 		self.rxBuffer.Remove(element)
-		self.receivedData(entry.Data)
+		if len(entry.Data) > 0 {
+			self.receivedData(entry.Data)
+		}
 		self.rxLastInSeq++
 	}
 }
@@ -354,6 +632,7 @@ func (self *conn) bufferRxData(seqNumber uint16, data []byte) {
 
 		// Duplicate segment already buffered
 		if entry.SeqNumber == seqNumber {
+			self.stats.DuplicatesDropped++
 			return
 		}
 
@@ -363,6 +642,11 @@ func (self *conn) bufferRxData(seqNumber uint16, data []byte) {
 		}
 	}
 
+	// Drop segments beyond MaxOutOfSeq, the sender retransmits them later
+	if self.rxBuffer.Len() >= self.maxOutOfSeq() {
+		return
+	}
+
 	entry := &rxBufferEntry{
 		SeqNumber: seqNumber,
 		Data:      data,
@@ -375,12 +659,49 @@ func (self *conn) bufferRxData(seqNumber uint16, data []byte) {
 	}
 }
 
-func (self *conn) connected() {
-	// TODO Notify listeners, start timers
-	self.state = stateOpen
+func (self *conn) setState(state State) {
+	from := self.state
+	if from == state {
+		return
+	}
+
+	self.state = state
+	self.notify(func(handler Handler) { handler.OnStateChange(from, state) })
+}
+
+// reset aborts the connection, notifying the peer with a RST carrying the
+// reason
+func (self *conn) reset(err error) {
+	self.sendRst(resetReason(err))
+	self.closed(err)
+}
+
+// resetReason is the reason carried in a RST, without the details of a
+// ProtocolError
+func resetReason(err error) string {
+	var protocolError *ProtocolError
+	if errors.As(err, &protocolError) {
+		return protocolError.Err.Error()
+	}
+
+	return err.Error()
+}
+
+// resetError is the error for a connection reset by the peer
+func resetError(segment *segment) error {
+	if len(segment.Data) == 0 {
+		return ErrConnectionReset
+	}
+
+	return fmt.Errorf("%w: %s", ErrConnectionReset, segment.Data)
 }
 
-func (self *conn) closed() {
-	// TODO Clean up connection, timers, listeners etc.
-	self.state = stateClosed
+func (self *conn) closed(err error) {
+	self.startQuietPeriod(err)
+	self.stopTimers()
+	self.err = err
+	self.setState(StateClosed)
+	self.rxReady.Broadcast()
+	self.txReady.Broadcast()
+	self.notify(func(handler Handler) { handler.OnClose(err) })
 }
@@ -2,12 +2,13 @@ package psst
 
 import (
 	"testing"
+	"time"
 )
 
 func TestSimpleAckHandling(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateOpen
+	conn.state = StateOpen
 	conn.config = defaultConfig()
 	conn.txNextSeq = 1
 	conn.txOldestUnacked = conn.txNextSeq - 1
@@ -25,9 +26,9 @@ func TestSimpleAckHandling(t *testing.T) {
 }
 
 func TestUintWrappingAckHandling(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateOpen
+	conn.state = StateOpen
 	conn.config = defaultConfig()
 	conn.txNextSeq = 0xFFFE
 	conn.txOldestUnacked = conn.txNextSeq - 1
@@ -54,9 +55,9 @@ func TestUintWrappingAckHandling(t *testing.T) {
 }
 
 func TestIntWrappingAckHandling(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateOpen
+	conn.state = StateOpen
 	conn.config = defaultConfig()
 	conn.txNextSeq = 0x7FFE
 	conn.txOldestUnacked = conn.txNextSeq - 1
@@ -83,9 +84,9 @@ func TestIntWrappingAckHandling(t *testing.T) {
 }
 
 func TestEakHandling(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateOpen
+	conn.state = StateOpen
 	conn.config = defaultConfig()
 	conn.txNextSeq = 1
 	conn.txOldestUnacked = conn.txNextSeq - 1
@@ -107,9 +108,9 @@ func TestEakHandling(t *testing.T) {
 }
 
 func TestOutOfSeqRxBuffer(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateOpen
+	conn.state = StateOpen
 	conn.config = defaultConfig()
 	conn.rxLastInSeq = 0
 
@@ -155,178 +156,179 @@ func TestOutOfSeqRxBuffer(t *testing.T) {
 }
 
 func TestClosedStateSegmentValidation(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateClosed
+	conn.state = StateClosed
 	conn.config = defaultConfig()
 
 	input := []struct {
 		*segment
-		action
+		Action
 	}{
-		{&segment{SYN: true, VarHeader: &synVarHeader{}}, actionDiscard},
-		{&segment{ACK: true, AckNumber: conn.txNextSeq - 1}, actionDiscard},
-		{&segment{RST: true}, actionDiscard},
+		{&segment{SYN: true, VarHeader: &synVarHeader{}}, ActionDiscard},
+		{&segment{ACK: true, AckNumber: conn.txNextSeq - 1}, ActionDiscard},
+		{&segment{RST: true}, ActionDiscard},
 	}
 
 	for _, i := range input {
-		if action, _ := conn.validateSegment(i.segment); action != i.action {
-			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.action)
+		if action, _ := conn.validateSegment(i.segment); action != i.Action {
+			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.Action)
 		}
 	}
 }
 
 func TestListenStateSegmentValidation(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateListen
+	conn.state = StateListen
 	conn.config = defaultConfig()
 
 	input := []struct {
 		*segment
-		action
+		Action
 	}{
-		{&segment{SYN: true, VarHeader: &synVarHeader{}}, actionContinue},
-		{&segment{ACK: true, AckNumber: conn.txNextSeq - 1}, actionDiscard},
-		{&segment{RST: true}, actionDiscard},
-		{&segment{SYN: true, ACK: true, AckNumber: conn.txNextSeq - 1, VarHeader: &synVarHeader{}}, actionDiscard},
-		{&segment{SYN: true}, actionReset},
+		{&segment{SYN: true, VarHeader: &synVarHeader{}}, ActionContinue},
+		{&segment{ACK: true, AckNumber: conn.txNextSeq - 1}, ActionDiscard},
+		{&segment{RST: true}, ActionDiscard},
+		{&segment{SYN: true, ACK: true, AckNumber: conn.txNextSeq - 1, VarHeader: &synVarHeader{}}, ActionDiscard},
+		{&segment{SYN: true}, ActionReset},
 	}
 
 	for _, i := range input {
-		if action, _ := conn.validateSegment(i.segment); action != i.action {
-			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.action)
+		if action, _ := conn.validateSegment(i.segment); action != i.Action {
+			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.Action)
 		}
 	}
 }
 
 func TestSynSentStateSegmentValidation(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateSynSent
+	conn.state = StateSynSent
 	conn.config = defaultConfig()
 
 	input := []struct {
 		*segment
-		action
+		Action
 	}{
-		{&segment{RST: true}, actionContinue},
-		{&segment{SYN: true, VarHeader: &synVarHeader{}}, actionContinue},
-		{&segment{SYN: true, ACK: true, AckNumber: conn.txNextSeq - 1, VarHeader: &synVarHeader{}}, actionContinue},
-		{&segment{ACK: true, AckNumber: conn.txNextSeq - 1}, actionDiscard},
-		{&segment{NUL: true}, actionDiscard},
-		{&segment{SYN: true}, actionReset},
+		{&segment{RST: true}, ActionContinue},
+		{&segment{SYN: true, VarHeader: &synVarHeader{}}, ActionContinue},
+		{&segment{SYN: true, ACK: true, AckNumber: conn.txNextSeq - 1, VarHeader: &synVarHeader{}}, ActionContinue},
+		{&segment{ACK: true, AckNumber: conn.txNextSeq - 1}, ActionDiscard},
+		{&segment{NUL: true}, ActionDiscard},
+		{&segment{SYN: true}, ActionReset},
 	}
 
 	for _, i := range input {
-		if action, _ := conn.validateSegment(i.segment); action != i.action {
-			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.action)
+		if action, _ := conn.validateSegment(i.segment); action != i.Action {
+			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.Action)
 		}
 	}
 }
 
 func TestSynReceivedStateSegmentValidation(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateSynReceived
+	conn.state = StateSynReceived
 	conn.config = defaultConfig()
 	conn.txNextSeq = 0x1234
 
 	input := []struct {
 		*segment
-		action
+		Action
 	}{
-		{&segment{RST: true}, actionContinue},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1}, actionContinue},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1, Data: []byte{0}}, actionContinue},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + conn.config.MaxOutstandingSegmentsSelf, AckNumber: conn.txNextSeq - 1, Data: []byte{0}}, actionContinue},
-		{&segment{ACK: true, NUL: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1}, actionContinue},
-		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1}, actionDiscard},
-		{&segment{SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, actionDiscard},
-		{&segment{SYN: true, VarHeader: &synVarHeader{}}, actionReset},
-		{&segment{SYN: true, ACK: true, AckNumber: conn.txNextSeq - 1, VarHeader: &synVarHeader{}}, actionReset},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq}, actionReset},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 2}, actionReset},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + (3 * conn.config.MaxOutstandingSegmentsSelf), AckNumber: conn.txNextSeq - 1, Data: []byte{0}}, actionAck},
+		{&segment{RST: true}, ActionContinue},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1}, ActionContinue},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1, Data: []byte{0}}, ActionContinue},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + conn.config.MaxOutstandingSegmentsSelf, AckNumber: conn.txNextSeq - 1, Data: []byte{0}}, ActionContinue},
+		{&segment{ACK: true, NUL: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1}, ActionContinue},
+		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1}, ActionDiscard},
+		{&segment{SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, ActionDiscard},
+		{&segment{SYN: true, VarHeader: &synVarHeader{}}, ActionReset},
+		{&segment{SYN: true, ACK: true, AckNumber: conn.txNextSeq - 1, VarHeader: &synVarHeader{}}, ActionReset},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq}, ActionReset},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 2}, ActionReset},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + (3 * conn.config.MaxOutstandingSegmentsSelf), AckNumber: conn.txNextSeq - 1, Data: []byte{0}}, ActionAck},
 	}
 
 	for _, i := range input {
-		if action, _ := conn.validateSegment(i.segment); action != i.action {
-			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.action)
+		if action, _ := conn.validateSegment(i.segment); action != i.Action {
+			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.Action)
 		}
 	}
 }
 
 func TestOpenStateSegmentValidation(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateOpen
+	conn.state = StateOpen
 	conn.config = defaultConfig()
 	conn.txNextSeq = 0x1234
 	conn.txOldestUnacked = conn.txNextSeq - 10
 
 	input := []struct {
 		*segment
-		action
+		Action
 	}{
-		{&segment{RST: true}, actionContinue},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked}, actionContinue},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, Data: []byte{0}}, actionContinue},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + conn.config.MaxOutstandingSegmentsSelf, AckNumber: conn.txOldestUnacked, Data: []byte{0}}, actionContinue},
-		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 2}}}, actionContinue},
-		{&segment{ACK: true, NUL: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked}, actionContinue},
-		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1}, actionContinue},
-		{&segment{SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, actionContinue},
-		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, actionDiscard},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq}, actionDiscard},
-		{&segment{EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 2}}}, actionDiscard},
-		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 20}}}, actionDiscard},
-		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked + 5, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 2}}}, actionDiscard},
-		{&segment{SYN: true, SeqNumber: conn.rxLastInSeq + 1, VarHeader: &synVarHeader{}}, actionReset},
-		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked}, actionReset},
-		{&segment{SYN: true, SeqNumber: conn.rxLastInSeq, VarHeader: &synVarHeader{}}, actionAck},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + (3 * conn.config.MaxOutstandingSegmentsSelf), AckNumber: conn.txNextSeq - 1, Data: []byte{0}}, actionAck},
+		{&segment{RST: true}, ActionContinue},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked}, ActionContinue},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, Data: []byte{0}}, ActionContinue},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + conn.config.MaxOutstandingSegmentsSelf, AckNumber: conn.txOldestUnacked, Data: []byte{0}}, ActionContinue},
+		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 2}}}, ActionContinue},
+		{&segment{ACK: true, NUL: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked}, ActionContinue},
+		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1}, ActionContinue},
+		{&segment{SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, ActionContinue},
+		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, ActionDiscard},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq}, ActionDiscard},
+		{&segment{EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 2}}}, ActionDiscard},
+		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 20}}}, ActionDiscard},
+		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked + 5, VarHeader: &eakVarHeader{EakNumbers: []uint16{conn.txOldestUnacked + 2}}}, ActionDiscard},
+		{&segment{SYN: true, SeqNumber: conn.rxLastInSeq + 1, VarHeader: &synVarHeader{}}, ActionReset},
+		{&segment{ACK: true, EAK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txOldestUnacked}, ActionReset},
+		{&segment{SYN: true, SeqNumber: conn.rxLastInSeq, VarHeader: &synVarHeader{}}, ActionAck},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + (3 * conn.config.MaxOutstandingSegmentsSelf), AckNumber: conn.txNextSeq - 1, Data: []byte{0}}, ActionAck},
 	}
 
 	for _, i := range input {
-		if action, _ := conn.validateSegment(i.segment); action != i.action {
-			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.action)
+		if action, _ := conn.validateSegment(i.segment); action != i.Action {
+			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.Action)
 		}
 	}
 }
 
 func TestCloseWaitStateSegmentValidation(t *testing.T) {
-	conn := NewConn()
+	conn := NewConn(&testTransport{})
 
-	conn.state = stateCloseWait
+	conn.state = StateCloseWait
 	conn.config = defaultConfig()
 	conn.txNextSeq = 0x1234
 
 	input := []struct {
 		*segment
-		action
+		Action
 	}{
-		{&segment{RST: true}, actionContinue},
-		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1}, actionDiscard},
-		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1}, actionDiscard},
-		{&segment{SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, actionDiscard},
-		{&segment{SYN: true, VarHeader: &synVarHeader{}}, actionDiscard},
+		{&segment{RST: true}, ActionContinue},
+		{&segment{ACK: true, SeqNumber: conn.rxLastInSeq + 1, AckNumber: conn.txNextSeq - 1}, ActionDiscard},
+		{&segment{NUL: true, SeqNumber: conn.rxLastInSeq + 1}, ActionDiscard},
+		{&segment{SeqNumber: conn.rxLastInSeq + 1, Data: []byte{0}}, ActionDiscard},
+		{&segment{SYN: true, VarHeader: &synVarHeader{}}, ActionDiscard},
 	}
 
 	for _, i := range input {
-		if action, _ := conn.validateSegment(i.segment); action != i.action {
-			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.action)
+		if action, _ := conn.validateSegment(i.segment); action != i.Action {
+			t.Fatalf("Segment validation action %v for segment %v doesn't match expected %v", action, i.segment, i.Action)
 		}
 	}
 }
 
 func defaultConfig() *connConfig {
 	return &connConfig{
+		MaxSegmentSize:             1024,
 		MaxOutstandingSegmentsSelf: 10,
 		MaxOutstandingSegmentsPeer: 10,
-		RetransmissionTimeout:      10,
-		CumulativeAckTimeout:       10,
-		NulTimeout:                 10,
+		RetransmissionTimeout:      10000,
+		CumulativeAckTimeout:       10000,
+		NulTimeout:                 10000,
 		MaxRetransmissions:         10,
 		MaxCumulativeAck:           10,
 		MaxOutOfSeq:                10,
@@ -337,6 +339,7 @@ func enqueueTxSegments(conn *conn, count int) {
 	for i := 0; i < count; i++ {
 		entry := &txBufferEntry{
 			SeqNumber: conn.txNextSeq,
+			sentAt:    time.Now(),
 		}
 
 		conn.txBuffer.PushBack(entry)
@@ -0,0 +1,88 @@
+package psst
+
+import (
+	"time"
+)
+
+// Stats is a snapshot of connection counters and gauges
+type Stats struct {
+	State State
+	// Transmitter counters
+	SegmentsSent          uint64
+	BytesSent             uint64
+	SegmentsRetransmitted uint64
+	BytesRetransmitted    uint64
+	// Retransmissions on EAK evidence, ahead of the retransmission timeout
+	FastRetransmits uint64
+	// Retransmissions of the newest segment when its ACK is overdue
+	TailLossProbes uint64
+	// NUL segments probing the peer's closed receive window
+	WindowProbes uint64
+	EaksSent     uint64
+	// Auto resets, initiated locally or by the peer
+	AutoResets uint64
+	// Receiver counters
+	SegmentsReceived  uint64
+	BytesReceived     uint64
+	EaksReceived      uint64
+	DuplicatesDropped uint64
+	// Segments failing validation, by resulting action
+	ValidationDiscards uint64
+	ValidationResets   uint64
+	ValidationAcks     uint64
+	// Gauges, RTT and RTO are the current round trip time and retransmission
+	// timeout estimates
+	TxBufferDepth int
+	RxBufferDepth int
+	RTT           time.Duration
+	RTO           time.Duration
+	// Largest segment confirmed to be delivered by the route, 0 while path
+	// payload size discovery is disabled
+	PathPayloadSize int
+}
+
+// Stats returns a snapshot of the connection statistics
+func (self *conn) Stats() Stats {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	stats := self.stats
+	stats.State = self.state
+	stats.TxBufferDepth = self.txBuffer.Len()
+	stats.RxBufferDepth = self.rxBuffer.Len()
+	stats.PathPayloadSize = self.path.size
+	if self.localConfig != nil {
+		stats.RTO = self.retransmissionTimeout()
+		stats.RTT = self.srtt
+	}
+
+	return stats
+}
+
+func (self *conn) countReceived(segment *segment) {
+	self.stats.SegmentsReceived++
+	self.stats.BytesReceived += uint64(len(segment.Data))
+
+	if segment.EAK {
+		self.stats.EaksReceived++
+	}
+}
+
+func (self *conn) countValidationFailure(action Action, segment *segment) {
+	switch action {
+
+	case ActionDiscard:
+		self.stats.ValidationDiscards++
+
+	case ActionReset:
+		self.stats.ValidationResets++
+
+	case ActionAck:
+		self.stats.ValidationAcks++
+		// Late or duplicate data segment already delivered
+		if len(segment.Data) > 0 && int16(segment.SeqNumber-self.rxLastInSeq) <= 0 {
+			self.stats.DuplicatesDropped++
+		}
+
+	}
+}
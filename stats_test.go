@@ -0,0 +1,52 @@
+package psst
+
+import (
+	"testing"
+)
+
+func TestReceiveStats(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.txNextSeq = 1
+	conn.txOldestUnacked = conn.txNextSeq - 1
+	conn.rxLastInSeq = 0
+
+	enqueueTxSegments(conn, 4)
+
+	input := []*segment{
+		{SeqNumber: 1, Data: []byte{0, 0}},
+		{SeqNumber: 3, Data: []byte{0}},
+		{SeqNumber: 3, Data: []byte{0}},
+		{SeqNumber: 1, Data: []byte{0}},
+		{ACK: true, EAK: true, SeqNumber: 2, AckNumber: 1, VarHeader: &eakVarHeader{EakNumbers: []uint16{3}}},
+		{NUL: true, SeqNumber: 2, Data: []byte{0}},
+		{SYN: true, SeqNumber: 2, VarHeader: &synVarHeader{}},
+	}
+
+	for _, segment := range input {
+		conn.receiveSegment(segment)
+	}
+
+	stats := conn.Stats()
+	expected := Stats{
+		State:              StateClosed,
+		SegmentsSent:       4,
+		EaksSent:           3,
+		BytesSent:          uint64(len(ErrInvalidFlags.Error())),
+		SegmentsReceived:   7,
+		BytesReceived:      6,
+		EaksReceived:       1,
+		DuplicatesDropped:  2,
+		ValidationDiscards: 1,
+		ValidationResets:   1,
+		ValidationAcks:     1,
+		TxBufferDepth:      2,
+		RxBufferDepth:      1,
+	}
+
+	if stats != expected {
+		t.Fatalf("Stats %+v don't match expected %+v", stats, expected)
+	}
+}
@@ -0,0 +1,137 @@
+package psst
+
+import (
+	"context"
+)
+
+// Stream reads and writes the connection as a byte stream. Writes are split
+// into segments of up to the negotiated MaxSegmentSize, or the payload size
+// the route delivers once path discovery has found it, and reads return
+// the data of successive segments in order regardless of how it was split.
+//
+// With CoalesceWrites set small writes are held back while data is
+// outstanding, and sent together once it is acknowledged or a full segment
+// has built up, in the spirit of Nagle's algorithm. Flush sends held back
+// data right away.
+//
+// Stream and message reads and writes share a single sequence, mixing them
+// is allowed but message boundaries are lost to Read. While a handler is
+// installed received data is delivered to OnData rather than Read.
+type Stream struct {
+	conn *conn
+}
+
+// Stream returns the conn as a byte stream
+func (self *conn) Stream() *Stream {
+	return &Stream{conn: self}
+}
+
+// Read reads received data in order, blocking until some is available. The
+// rest of a segment larger than buffer is left for the next read. Once the
+// connection is closed and all data has been read it returns the error the
+// connection was closed with, or io.EOF.
+func (self *Stream) Read(buffer []byte) (int, error) {
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+
+	data, err := self.conn.nextMessage(context.Background(), len(buffer))
+	return copy(buffer, data), err
+}
+
+// Write sends data as segments of up to MaxSegmentSize, blocking while the
+// window is full like the conn's Write. In non-blocking mode it returns the
+// number of bytes accepted along with ErrWouldBlock.
+func (self *Stream) Write(data []byte) (int, error) {
+	conn := self.conn
+	conn.mutex.Lock()
+	defer conn.unlock()
+
+	written := 0
+	for len(data) > 0 {
+		if err := conn.openErr(); err != nil {
+			return written, err
+		}
+		mss := conn.streamSegmentSize()
+
+		if conn.coalescing() {
+			// Data held back may exceed a segment once the path payload
+			// size has shrunk, it is then flushed before taking more
+			size := max(0, min(len(data), mss-len(conn.txPending)))
+			conn.txPending = append(conn.txPending, data[:size]...)
+			data = data[size:]
+			written += size
+
+			// A full segment goes out as soon as there's room
+			if len(conn.txPending) >= mss {
+				if err := conn.flushPending(); err != nil {
+					return written, err
+				}
+			}
+			continue
+		}
+
+		if err := conn.waitWritable(); err != nil {
+			return written, err
+		}
+
+		size := min(len(data), mss)
+		conn.transmit(&txBufferEntry{
+			Data: append([]byte(nil), data[:size]...),
+		})
+		data = data[size:]
+		written += size
+	}
+
+	conn.sendCoalesced()
+	return written, nil
+}
+
+// Flush sends data held back to coalesce small writes, blocking while the
+// window is full
+func (self *Stream) Flush() error {
+	self.conn.mutex.Lock()
+	defer self.conn.unlock()
+	return self.conn.flushPending()
+}
+
+func (self *conn) coalescing() bool {
+	return self.localConfig != nil && self.localConfig.CoalesceWrites
+}
+
+// flushPending sends data held back to coalesce small writes once there's
+// room
+func (self *conn) flushPending() error {
+	for len(self.txPending) > 0 {
+		if err := self.waitWritable(); err != nil {
+			return err
+		}
+
+		// The wait may have let an ACK send it already
+		if len(self.txPending) > 0 {
+			self.transmit(&txBufferEntry{Data: self.takePending()})
+		}
+	}
+	return nil
+}
+
+// sendCoalesced sends held back data once nothing is outstanding, or once
+// a full segment has built up
+func (self *conn) sendCoalesced() {
+	for len(self.txPending) > 0 && self.writable() && (self.txBuffer.Len() == 0 || len(self.txPending) >= self.streamSegmentSize()) {
+		self.transmit(&txBufferEntry{Data: self.takePending()})
+	}
+}
+
+// takePending takes held back data for the next segment, up to the stream
+// segment size as the path payload size may have shrunk since it was held
+func (self *conn) takePending() []byte {
+	size := min(len(self.txPending), self.streamSegmentSize())
+	data := self.txPending[:size:size]
+
+	self.txPending = self.txPending[size:]
+	if len(self.txPending) == 0 {
+		self.txPending = nil
+	}
+	return data
+}
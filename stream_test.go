@@ -0,0 +1,126 @@
+package psst
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func streamPair(config *Config, t *testing.T) (*conn, *conn) {
+	listener := NewConn(&testTransport{})
+	listener.Listen(config)
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(config)
+
+	exchange(listener, dialer, t)
+	return listener, dialer
+}
+
+func TestStreamSegmentation(t *testing.T) {
+	config := transferConfig()
+	config.MaxSegmentSize = 4
+
+	listener, dialer := streamPair(config, t)
+
+	data := []byte("0123456789")
+	if written, err := dialer.Stream().Write(data); written != len(data) || err != nil {
+		t.Fatalf("Write wrote %d with %v", written, err)
+	}
+
+	segments := dialer.transport.(*testTransport).take()
+	for i, size := range []int{4, 4, 2} {
+		if i >= len(segments) || len(segments[i].Data) != size {
+			t.Fatalf("Sent %v, expected segments of 4, 4 and 2 octets", segments)
+		}
+		listener.receiveSegment(segments[i])
+	}
+
+	// Reads of any size rebuild the stream
+	stream := listener.Stream()
+	read := make([]byte, len(data))
+	for start, size := 0, 3; start < len(read); start += size {
+		if _, err := io.ReadFull(stream, read[start:min(start+size, len(read))]); err != nil {
+			t.Fatalf("Read failed with %v", err)
+		}
+	}
+
+	if string(read) != string(data) {
+		t.Fatalf("Read %q, expected %q", read, data)
+	}
+
+	closePair(listener, dialer)
+}
+
+func TestCoalescedWrites(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.localConfig = DefaultConfig()
+	conn.localConfig.CoalesceWrites = true
+	conn.config = defaultConfig()
+	conn.config.MaxSegmentSize = 4
+	conn.txNextSeq = 1
+	conn.txOldestUnacked = 0
+
+	stream := conn.Stream()
+	for _, data := range []string{"a", "b", "c", "defg"} {
+		stream.Write([]byte(data))
+	}
+
+	// The first write goes out as nothing is outstanding, the others are
+	// held back until they fill a segment
+	validateData(transport.take(), []string{"a", "bcde"}, t)
+
+	conn.receiveSegment(&segment{ACK: true, SeqNumber: 1, AckNumber: 2})
+	validateData(transport.take(), []string{"fg"}, t)
+
+	stream.Write([]byte("h"))
+	stream.Flush()
+	validateData(transport.take(), []string{"h"}, t)
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
+
+func TestOversizeSegment(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.MaxSegmentSize = 4
+	conn.rxLastInSeq = 0
+
+	if err := conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte("01234")}); !errors.Is(err, ErrOversizeSegment) {
+		t.Fatalf("Segment beyond MaxSegmentSize failed with %v, expected oversize segment", err)
+	}
+
+	if stats := conn.Stats(); stats.ValidationDiscards != 1 || stats.RxBufferDepth != 0 {
+		t.Fatalf("Stats %+v after oversize segment", stats)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
+
+func validateData(segments []*segment, expected []string, t *testing.T) {
+	var data []string
+	for _, segment := range segments {
+		if len(segment.Data) > 0 {
+			data = append(data, string(segment.Data))
+		}
+	}
+
+	if len(data) != len(expected) {
+		t.Fatalf("Sent data %q, expected %q", data, expected)
+	}
+
+	for i := range data {
+		if data[i] != expected[i] {
+			t.Fatalf("Sent data %q, expected %q", data, expected)
+		}
+	}
+}
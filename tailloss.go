@@ -0,0 +1,107 @@
+package psst
+
+import (
+	"time"
+)
+
+// When the last segments of a burst are lost no later segment draws an EAK
+// that would reveal the loss, and recovery waits for the retransmission
+// timeout. A tail loss probe, in the manner of RFC 8985, resends the newest
+// outstanding segment shortly after its ACK is expected instead. Should the
+// probe fill the gap, the peer's ACK acknowledges the whole tail. Should
+// more than the newest segment have been lost, the EAK for the probe
+// brings the others to fast retransmit. One probe is sent per flight, until
+// an ACK makes progress. Probes are not charged against the retransmission
+// limit, which is left to the timeout.
+
+// tailLossProbing reports whether tail loss probes are enabled
+func (self *conn) tailLossProbing() bool {
+	return self.localConfig != nil && self.localConfig.TailLossProbe
+}
+
+// tailLossProbeTimeout is the time after the newest transmission at which
+// its ACK is overdue: twice the smoothed round trip time as in RFC 8985,
+// plus the time the peer may hold back a cumulative ACK
+func (self *conn) tailLossProbeTimeout(inFlight int) time.Duration {
+	timeout := max(2*self.srtt, clockGranularity)
+	if self.config.MaxCumulativeAck != 0 && inFlight < int(self.config.MaxCumulativeAck) {
+		timeout += millisToDuration(self.config.CumulativeAckTimeout)
+	}
+
+	return timeout
+}
+
+// armTailLossProbe schedules a probe of the newest outstanding segment, or
+// stops it when nothing is outstanding, a probe has been sent for the
+// flight already or the retransmission timer would expire first
+func (self *conn) armTailLossProbe() {
+	if self.tailLossTimer != nil {
+		self.tailLossTimer.Stop()
+		self.tailLossTimer = nil
+	}
+
+	// Until the round trip time is measured there's no telling when an ACK
+	// is due
+	if !self.tailLossProbing() || self.state != StateOpen || self.tailProbed || self.srtt == 0 {
+		return
+	}
+
+	var oldest, newest time.Time
+	inFlight := 0
+	for element := self.txBuffer.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*txBufferEntry)
+		if entry.paced {
+			continue
+		}
+
+		inFlight++
+		if oldest.IsZero() || entry.sentAt.Before(oldest) {
+			oldest = entry.sentAt
+		}
+		if entry.sentAt.After(newest) {
+			newest = entry.sentAt
+		}
+	}
+
+	if inFlight == 0 {
+		return
+	}
+
+	probeAt := newest.Add(self.tailLossProbeTimeout(inFlight))
+	if !probeAt.Before(oldest.Add(self.retransmissionTimeout())) {
+		return
+	}
+
+	self.tailLossTimer = time.AfterFunc(time.Until(probeAt), self.tailLossTimerExpired)
+}
+
+func (self *conn) tailLossTimerExpired() {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	self.tailLossTimer = nil
+
+	if self.state != StateOpen || self.tailProbed {
+		return
+	}
+
+	// Segments still waiting for the pacer are not yet overdue
+	var entry *txBufferEntry
+	for element := self.txBuffer.Back(); element != nil; element = element.Prev() {
+		if entry = element.Value.(*txBufferEntry); !entry.paced {
+			break
+		}
+		entry = nil
+	}
+
+	if entry == nil {
+		return
+	}
+
+	self.tailProbed = true
+	entry.probed = true
+	self.stats.TailLossProbes++
+	self.stats.SegmentsRetransmitted++
+	self.stats.BytesRetransmitted += uint64(len(entry.Data))
+	self.send(entry)
+}
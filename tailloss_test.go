@@ -0,0 +1,60 @@
+package psst
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTailLossProbe(t *testing.T) {
+	conn := windowConn()
+	conn.config.MaxOutstandingSegmentsPeer = 10
+	conn.config.MaxCumulativeAck = 0
+	conn.localConfig = DefaultConfig()
+	conn.congestion = &recordingController{window: 100}
+	conn.srtt = 20 * time.Millisecond
+	conn.rto = time.Second
+	transport := conn.transport.(*testTransport)
+
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		conn.Write([]byte{byte(i)})
+	}
+	transport.take()
+
+	// The newest segment is resent once its ACK is overdue, well ahead of
+	// the retransmission timeout
+	segments, end := waitSent(transport, 1, t)
+	if len(segments) != 1 || segments[0].SeqNumber != 3 {
+		t.Fatalf("Sent %v, expected a probe of the newest segment", segments)
+	}
+
+	if elapsed := end.Sub(start); elapsed < 40*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Fatalf("Probe sent after %v, expected 40ms", elapsed)
+	}
+
+	// The probe isn't charged against the retransmission limit
+	if entry := conn.txBuffer.Back().Value.(*txBufferEntry); entry.txCount != 0 || !entry.probed {
+		t.Fatalf("Probed entry %+v, expected no retransmission counted", entry)
+	}
+
+	// One probe per flight
+	time.Sleep(100 * time.Millisecond)
+	if segments := transport.take(); len(segments) != 0 {
+		t.Fatalf("Sent %v after the probe, expected nothing", segments)
+	}
+
+	// Progress allows the next flight a probe
+	conn.receiveSegment(&segment{ACK: true, SeqNumber: 1, AckNumber: 3})
+	conn.Write([]byte{4})
+	if segments, _ := waitSent(transport, 2, t); segments[1].SeqNumber != 4 {
+		t.Fatalf("Sent %v, expected a probe of the next flight", segments)
+	}
+
+	if stats := conn.Stats(); stats.TailLossProbes != 2 || stats.SegmentsRetransmitted != 2 {
+		t.Fatalf("Stats %+v don't count tail loss probes", stats)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
@@ -0,0 +1,363 @@
+package psst
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"time"
+)
+
+// transferState is the state of a suspended connection
+type transferState struct {
+	LocalConfig     *Config
+	Config          connConfig
+	Client          bool
+	ID              uint32
+	TxNextSeq       uint16
+	TxOldestUnacked uint16
+	TxBuffer        []transferTxEntry
+	RxLastInSeq     uint16
+	RxBuffer        []rxBufferEntry
+	RxQueue         [][]byte
+	AutoResets      uint8
+	TxPending       []byte
+	// Initial sequence numbers, kept to tell auto resets from delayed SYNs
+	TxInitialSeq, TxSequenceStart uint16
+	RxInitialSeq, RxSequenceStart uint16
+	// Transfer epochs, kept to tell replayed TCS segments apart
+	TxTransferEpoch, RxTransferEpoch uint32
+}
+
+type transferTxEntry struct {
+	SeqNumber uint16
+	NUL, TCS  bool
+	Data      []byte
+}
+
+// ID identifies the connection to the peer in TCS segments, it is set once
+// the connection is established
+func (self *conn) ID() uint32 {
+	self.mutex.Lock()
+	defer self.unlock()
+	return self.id
+}
+
+// TransferID returns the connection identifier of a serialised TCS segment,
+// for finding the conn to pass it to with ReceiveTransfer. Any other segment
+// returns false.
+func TransferID(data []byte) (uint32, bool) {
+	segment := &segment{}
+	if err := segment.UnmarshalBinary(data); err != nil || !segment.TCS {
+		return 0, false
+	}
+
+	tcsHeader, ok := segment.VarHeader.(*tcsVarHeader)
+	if !ok {
+		return 0, false
+	}
+
+	return tcsHeader.ConnID, true
+}
+
+// AddressTransport is a Transport that knows the address the peer reaches
+// the local end at over it, such as the local PSS address. TCS segments sent
+// over it are bound to the address, and the peer only accepts them from a
+// PeerTransport to that address.
+type AddressTransport interface {
+	Transport
+	LocalAddress() string
+}
+
+func localAddress(transport Transport) string {
+	if transport, ok := transport.(AddressTransport); ok {
+		return transport.LocalAddress()
+	}
+
+	return ""
+}
+
+func peerAddress(transport Transport) string {
+	if transport, ok := transport.(PeerTransport); ok {
+		return transport.Peer()
+	}
+
+	return ""
+}
+
+// Transfer moves the connection to a new transport, for example when the
+// local PSS address has changed. A TCS segment authenticated with the
+// TransferKey is sent over it, so that the peer moves its end of the
+// connection to the new address as well. Unacknowledged data is
+// retransmitted over the new transport.
+func (self *conn) Transfer(transport Transport) error {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	if self.state != StateOpen {
+		if self.err != nil {
+			return self.err
+		}
+		return ErrNotOpen
+	}
+
+	if len(self.localConfig.TransferKey) == 0 {
+		return ErrNoTransferKey
+	}
+
+	if len(localAddress(transport)) > maxTransferAddress {
+		return ErrAddressTooLong
+	}
+
+	self.transport = transport
+	self.resetCongestion()
+	self.txTransferEpoch++
+	self.transmit(&txBufferEntry{tcs: true})
+
+	return nil
+}
+
+// ReceiveTransfer processes a serialised TCS segment from the peer, received
+// from an address other than the one the connection is using. Once the
+// segment has been authenticated the connection is moved to transport, which
+// sends to the peer's new address.
+func (self *conn) ReceiveTransfer(data []byte, transport Transport) error {
+	segment := &segment{}
+	if err := segment.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.unlock()
+
+	if !segment.TCS {
+		_, err := self.reject(ActionDiscard, ErrInvalidFlags, segment)
+		return err
+	}
+
+	// Nothing is sent in response to a segment that can't be authenticated,
+	// or that has already been received out of sequence. The segment is
+	// authenticated against the address of the new transport.
+	previous := self.transport
+	self.transport = transport
+	action, err := self.validateSegment(segment)
+	if action == ActionContinue && self.rxBuffered(segment.SeqNumber) {
+		action, err = self.reject(ActionDiscard, ErrUnexpectedSeqNumber, segment)
+	}
+
+	if action != ActionContinue {
+		self.transport = previous
+		self.countReceived(segment)
+		self.countValidationFailure(ActionDiscard, segment)
+		return err
+	}
+
+	self.resetCongestion()
+	return self.handleSegment(segment)
+}
+
+// Suspend closes the connection with ErrTransferred without notifying the
+// peer, and returns its state for Resume. This includes data received but
+// not yet read, and the TransferKey, so it must be stored securely.
+func (self *conn) Suspend() ([]byte, error) {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	if self.state != StateOpen {
+		if self.err != nil {
+			return nil, self.err
+		}
+		return nil, ErrNotOpen
+	}
+
+	state := transferState{
+		LocalConfig:     self.localConfig,
+		Config:          *self.config,
+		Client:          self.client,
+		ID:              self.id,
+		TxNextSeq:       self.txNextSeq,
+		TxOldestUnacked: self.txOldestUnacked,
+		RxLastInSeq:     self.rxLastInSeq,
+		AutoResets:      self.autoResets,
+		TxPending:       self.txPending,
+		TxInitialSeq:    self.txInitialSeq,
+		TxSequenceStart: self.txSequenceStart,
+		RxInitialSeq:    self.rxInitialSeq,
+		RxSequenceStart: self.rxSequenceStart,
+		TxTransferEpoch: self.txTransferEpoch,
+		RxTransferEpoch: self.rxTransferEpoch,
+	}
+
+	for element := self.txBuffer.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*txBufferEntry)
+		state.TxBuffer = append(state.TxBuffer, transferTxEntry{entry.SeqNumber, entry.nul, entry.tcs, entry.Data})
+	}
+
+	for element := self.rxBuffer.Front(); element != nil; element = element.Next() {
+		state.RxBuffer = append(state.RxBuffer, *element.Value.(*rxBufferEntry))
+	}
+
+	for element := self.rxQueue.Front(); element != nil; element = element.Next() {
+		state.RxQueue = append(state.RxQueue, element.Value.([]byte))
+	}
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&state); err != nil {
+		return nil, err
+	}
+
+	// The unread data moves with the state
+	self.rxQueue.Init()
+	self.fire(eventSuspend, nil, ErrTransferred)
+
+	return buffer.Bytes(), nil
+}
+
+// Resume opens a new conn with the state of a suspended one, on the same
+// node or after a restart. When a TransferKey is configured the peer is sent
+// a TCS segment over the conn's transport, so the address may differ from
+// the one the connection was suspended at.
+func (self *conn) Resume(data []byte) error {
+	var state transferState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.unlock()
+
+	if self.state != StateClosed {
+		return ErrConnectionInUse
+	}
+
+	self.localConfig = state.LocalConfig
+	self.config = &state.Config
+	self.client = state.Client
+	self.id = state.ID
+	self.txNextSeq = state.TxNextSeq
+	self.txOldestUnacked = state.TxOldestUnacked
+	self.rxLastInSeq = state.RxLastInSeq
+	self.autoResets = state.AutoResets
+	self.txPending = state.TxPending
+	self.txInitialSeq = state.TxInitialSeq
+	self.txSequenceStart = state.TxSequenceStart
+	self.rxInitialSeq = state.RxInitialSeq
+	self.rxSequenceStart = state.RxSequenceStart
+	self.txTransferEpoch = state.TxTransferEpoch
+	self.rxTransferEpoch = state.RxTransferEpoch
+	self.err = nil
+	self.txWindowAdvertised = false
+	self.probes = 0
+	self.tailProbed = false
+	self.resetCongestion()
+
+	// Buffered data is retransmitted once the connection is open
+	self.txBuffer.Init()
+	for _, entry := range state.TxBuffer {
+		self.txBuffer.PushBack(&txBufferEntry{SeqNumber: entry.SeqNumber, nul: entry.NUL, tcs: entry.TCS, Data: entry.Data})
+	}
+
+	self.rxBuffer.Init()
+	for i := range state.RxBuffer {
+		self.rxBuffer.PushBack(&state.RxBuffer[i])
+	}
+
+	self.rxQueue.Init()
+	for _, data := range state.RxQueue {
+		self.receivedData(data)
+	}
+
+	self.lastReceived = time.Now()
+	return self.fire(eventResume, nil, nil)
+}
+
+// resendTxBuffer retransmits the data that was unacknowledged when the
+// connection was suspended, as its retransmission timer didn't move with it
+func (self *conn) resendTxBuffer() {
+	for element := self.txBuffer.Front(); element != nil; element = element.Next() {
+		self.retransmitEntry(element.Value.(*txBufferEntry))
+	}
+}
+
+// announceResume tells the peer where a resumed connection is, with a TCS
+// segment when a TransferKey is configured
+func (self *conn) announceResume() {
+	if len(self.localConfig.TransferKey) > 0 {
+		self.txTransferEpoch++
+		self.transmit(&txBufferEntry{tcs: true})
+	} else {
+		self.sendAck()
+	}
+}
+
+func (self *conn) rxBuffered(seqNumber uint16) bool {
+	for element := self.rxBuffer.Front(); element != nil; element = element.Next() {
+		if element.Value.(*rxBufferEntry).SeqNumber == seqNumber {
+			return true
+		}
+	}
+
+	return false
+}
+
+// connID identifies a connection from the initial sequence numbers of the
+// dialer and the listener
+func connID(client bool, local, peer uint16) uint32 {
+	if client {
+		return uint32(local)<<16 | uint32(peer)
+	}
+
+	return uint32(peer)<<16 | uint32(local)
+}
+
+func (self *conn) tcsHeader(seqNumber uint16) *tcsVarHeader {
+	tcsHeader := &tcsVarHeader{
+		ConnID:  self.id,
+		Epoch:   self.txTransferEpoch,
+		Address: localAddress(self.transport),
+	}
+	copy(tcsHeader.MAC[:], self.transferMAC(seqNumber, tcsHeader.Epoch, tcsHeader.Address))
+	return tcsHeader
+}
+
+// authenticTransfer checks a TCS segment is for this connection, was sent by
+// a holder of the TransferKey from the address of the transport, and is newer
+// than the last transfer. Replays are rejected by the sequence number check
+// as the segment consumes its sequence number, and by the epoch once the
+// sequence numbers have wrapped around.
+func (self *conn) authenticTransfer(segment *segment) bool {
+	tcsHeader, ok := segment.VarHeader.(*tcsVarHeader)
+	if !ok || tcsHeader.ConnID != self.id || self.localConfig == nil || len(self.localConfig.TransferKey) == 0 {
+		return false
+	}
+
+	if tcsHeader.Epoch <= self.rxTransferEpoch || tcsHeader.Address != peerAddress(self.transport) {
+		return false
+	}
+
+	if !hmac.Equal(tcsHeader.MAC[:], self.transferMAC(segment.SeqNumber, tcsHeader.Epoch, tcsHeader.Address)) {
+		return false
+	}
+
+	return true
+}
+
+// receivedTransfer takes the epoch of a TCS segment that has been accepted
+func (self *conn) receivedTransfer(segment *segment) {
+	self.rxTransferEpoch = max(self.rxTransferEpoch, segment.VarHeader.(*tcsVarHeader).Epoch)
+}
+
+// transferMAC authenticates the connection identifier, sequence number,
+// epoch and address of a TCS segment
+func (self *conn) transferMAC(seqNumber uint16, epoch uint32, address string) []byte {
+	message := make([]byte, 10, 10+len(address))
+	binary.BigEndian.PutUint32(message, self.id)
+	binary.BigEndian.PutUint16(message[4:], seqNumber)
+	binary.BigEndian.PutUint32(message[6:], epoch)
+	message = append(message, address...)
+
+	mac := hmac.New(sha256.New, self.localConfig.TransferKey)
+	mac.Write(message)
+	return mac.Sum(nil)[:16]
+}
@@ -0,0 +1,260 @@
+package psst
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func transferConfig() *Config {
+	config := DefaultConfig()
+	config.RetransmissionTimeout = 10 * time.Second
+	config.CumulativeAckTimeout = 5 * time.Second
+	config.TransferKey = []byte("transfer key")
+	return config
+}
+
+func connectPair(t *testing.T) (*conn, *conn) {
+	listener := NewConn(&testTransport{})
+	listener.Listen(transferConfig())
+
+	dialer := NewConn(&testTransport{})
+	dialer.Dial(transferConfig())
+
+	exchange(listener, dialer, t)
+
+	if listener.state != StateOpen || dialer.state != StateOpen || listener.ID() != dialer.ID() {
+		t.Fatalf("Connection in %v and %v with identifiers %x and %x", listener.state, dialer.state, listener.ID(), dialer.ID())
+	}
+
+	return listener, dialer
+}
+
+func closePair(a, b *conn) {
+	for _, conn := range []*conn{a, b} {
+		conn.mutex.Lock()
+		conn.closed(nil)
+		conn.unlock()
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	listener, dialer := connectPair(t)
+	listenerTransport := listener.transport
+
+	// Data lost on the old route is retransmitted over the new one
+	dialer.Write([]byte{0xa})
+	dialer.transport.(*testTransport).take()
+
+	dialerTransport := &testTransport{}
+	if err := dialer.Transfer(dialerTransport); err != nil {
+		t.Fatalf("Transfer failed with %v", err)
+	}
+
+	segments := dialerTransport.take()
+	if len(segments) != 1 || !segments[0].TCS || segments[0].SeqNumber != dialer.txNextSeq-1 {
+		t.Fatalf("Transfer sent %v, expected TCS", segments)
+	}
+
+	tcs := marshalSegment(segments[0], t)
+	if id, ok := TransferID(tcs); !ok || id != listener.ID() {
+		t.Fatalf("TCS identifier %x doesn't match %x", id, listener.ID())
+	}
+
+	// A TCS from a conn without the key is ignored
+	forger := NewConn(&testTransport{})
+	forger.id = dialer.id
+	forger.localConfig = DefaultConfig()
+	forger.localConfig.TransferKey = []byte("guessed key")
+	forged := marshalSegment(&segment{ACK: true, TCS: true, SeqNumber: segments[0].SeqNumber, AckNumber: segments[0].AckNumber, VarHeader: forger.tcsHeader(segments[0].SeqNumber)}, t)
+
+	forgerTransport := &testTransport{}
+	if err := listener.ReceiveTransfer(forged, forgerTransport); !errors.Is(err, ErrInvalidTransfer) {
+		t.Fatalf("Forged transfer failed with %v, expected authentication failure", err)
+	}
+
+	if listener.transport != listenerTransport || len(forgerTransport.take()) != 0 || len(listenerTransport.(*testTransport).take()) != 0 {
+		t.Fatalf("Listener moved or responded to forged transfer")
+	}
+
+	listener.SetHandler(&recordingHandler{})
+	newListenerTransport := &testTransport{}
+	if err := listener.ReceiveTransfer(tcs, newListenerTransport); err != nil {
+		t.Fatalf("Transfer failed with %v", err)
+	}
+
+	if listener.transport != newListenerTransport {
+		t.Fatalf("Listener not moved to new transport")
+	}
+
+	// Replaying the TCS no longer moves the connection, its epoch has been
+	// taken
+	if err := listener.ReceiveTransfer(tcs, forgerTransport); !errors.Is(err, ErrInvalidTransfer) || listener.transport != newListenerTransport {
+		t.Fatalf("Replayed transfer failed with %v, expected authentication failure", err)
+	}
+
+	dialer.mutex.Lock()
+	dialer.txBuffer.Front().Value.(*txBufferEntry).sentAt = time.Time{}
+	dialer.retransmit()
+	dialer.unlock()
+
+	exchange(listener, dialer, t)
+	listener.cumulativeAckTimerExpired()
+	exchange(listener, dialer, t)
+
+	validateEvents(listener.handler.(*recordingHandler), []string{"data 0a"}, t)
+	validateTxBuffer(dialer, []uint16{}, t)
+
+	closePair(listener, dialer)
+}
+
+func TestTransferBinding(t *testing.T) {
+	listener, dialer := connectPair(t)
+
+	dialerTransport := &peerTransport{peer: "listener", local: "dialer 2"}
+	if err := dialer.Transfer(dialerTransport); err != nil {
+		t.Fatalf("Transfer failed with %v", err)
+	}
+
+	segments := dialerTransport.take()
+	if len(segments) != 1 || segments[0].VarHeader.(*tcsVarHeader).Address != "dialer 2" || segments[0].VarHeader.(*tcsVarHeader).Epoch != 1 {
+		t.Fatalf("Transfer sent %v, expected TCS bound to the new address", segments)
+	}
+	tcs := marshalSegment(segments[0], t)
+
+	// The TCS is only accepted from the address it was sent from
+	if err := listener.ReceiveTransfer(tcs, &peerTransport{peer: "attacker"}); !errors.Is(err, ErrInvalidTransfer) {
+		t.Fatalf("Transfer from another address failed with %v, expected authentication failure", err)
+	}
+
+	if err := listener.ReceiveTransfer(tcs, &peerTransport{peer: "dialer 2"}); err != nil {
+		t.Fatalf("Transfer failed with %v", err)
+	}
+
+	// Once the sequence numbers wrap around the epoch still rejects it
+	listener.mutex.Lock()
+	listener.rxLastInSeq = segments[0].SeqNumber - 1
+	listener.unlock()
+
+	if err := listener.ReceiveTransfer(tcs, &peerTransport{peer: "dialer 2"}); !errors.Is(err, ErrInvalidTransfer) {
+		t.Fatalf("Transfer replayed after wraparound failed with %v, expected authentication failure", err)
+	}
+
+	closePair(listener, dialer)
+}
+
+func TestSuspendResume(t *testing.T) {
+	listener, dialer := connectPair(t)
+
+	dialer.Write([]byte{0xa})
+	exchange(listener, dialer, t)
+
+	// Unacknowledged and unread data moves with the state
+	listener.Write([]byte{0xb})
+	listener.transport.(*testTransport).take()
+
+	state, err := listener.Suspend()
+	if err != nil {
+		t.Fatalf("Suspend failed with %v", err)
+	}
+
+	if listener.state != StateClosed || listener.err != ErrTransferred || listener.rxQueue.Len() != 0 {
+		t.Fatalf("Connection in %v with error %v once suspended", listener.state, listener.err)
+	}
+
+	// Stragglers reaching the suspended conn don't reset the peer
+	dialer.Write([]byte{0xc})
+	straggler := dialer.transport.(*testTransport).take()[0]
+	if err := listener.Receive(marshalSegment(straggler, t)); !errors.Is(err, ErrUnexpectedSegment) || len(listener.transport.(*testTransport).take()) != 0 {
+		t.Fatalf("Straggler failed with %v once suspended, expected discard", err)
+	}
+
+	resumed := NewConn(&testTransport{})
+	if err := resumed.Resume(state); err != nil {
+		t.Fatalf("Resume failed with %v", err)
+	}
+
+	if resumed.state != StateOpen || resumed.ID() != dialer.ID() {
+		t.Fatalf("Resumed connection in %v with identifier %x", resumed.state, resumed.ID())
+	}
+
+	if message, err := resumed.ReadMessage(); err != nil || !bytes.Equal(message, []byte{0xa}) {
+		t.Fatalf("Resumed connection read %x with %v", message, err)
+	}
+
+	// Unacknowledged data is resent along with the TCS
+	segments := resumed.transport.(*testTransport).take()
+	if len(segments) != 2 || !bytes.Equal(segments[0].Data, []byte{0xb}) || !segments[1].TCS {
+		t.Fatalf("Resumed connection sent %v, expected the buffered data and TCS", segments)
+	}
+
+	if err := dialer.ReceiveTransfer(marshalSegment(segments[1], t), &testTransport{}); err != nil {
+		t.Fatalf("Transfer failed with %v", err)
+	}
+
+	if err := dialer.Receive(marshalSegment(segments[0], t)); err != nil {
+		t.Fatalf("Resent data failed with %v", err)
+	}
+
+	exchange(resumed, dialer, t)
+	dialer.cumulativeAckTimerExpired()
+	exchange(resumed, dialer, t)
+
+	if message, err := dialer.ReadMessage(); err != nil || !bytes.Equal(message, []byte{0xb}) {
+		t.Fatalf("Dialer read %x with %v after resume", message, err)
+	}
+
+	validateTxBuffer(resumed, []uint16{}, t)
+
+	closePair(resumed, dialer)
+}
+
+func TestResumeWithoutKey(t *testing.T) {
+	conn := windowConn()
+	conn.localConfig = DefaultConfig()
+
+	conn.Write([]byte{1})
+	state, err := conn.Suspend()
+	if err != nil {
+		t.Fatalf("Suspend failed with %v", err)
+	}
+
+	// Without a TCS segment to carry it, the buffered data is resent on its
+	// own and retransmitted until acknowledged
+	transport := &testTransport{}
+	resumed := NewConn(transport)
+	if err := resumed.Resume(state); err != nil {
+		t.Fatalf("Resume failed with %v", err)
+	}
+
+	segments := transport.take()
+	if len(segments) != 2 || segments[0].SeqNumber != 1 || !bytes.Equal(segments[0].Data, []byte{1}) || !segments[1].ACK || len(segments[1].Data) != 0 {
+		t.Fatalf("Resumed connection sent %v, expected the buffered data and ACK", segments)
+	}
+
+	if resumed.retransmissionTimer == nil {
+		t.Fatalf("Retransmission timer not armed for the buffered data")
+	}
+
+	resumed.mutex.Lock()
+	resumed.closed(nil)
+	resumed.unlock()
+}
+
+func TestTransferWithoutKey(t *testing.T) {
+	conn := NewConn(&testTransport{})
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.localConfig = DefaultConfig()
+
+	if err := conn.Transfer(&testTransport{}); err != ErrNoTransferKey {
+		t.Fatalf("Transfer failed with %v, expected missing key", err)
+	}
+
+	action, err := conn.validateSegment(&segment{TCS: true, SeqNumber: conn.rxLastInSeq + 1, VarHeader: &tcsVarHeader{}})
+	if action != ActionDiscard || !errors.Is(err, ErrInvalidTransfer) {
+		t.Fatalf("TCS without key validated with %v, expected discard", err)
+	}
+}
@@ -0,0 +1,295 @@
+package psst
+
+//go:generate go test -run TestStateDiagrams -update
+
+import (
+	"fmt"
+	"strings"
+)
+
+// event drives a state transition
+type event int
+
+const (
+	// Application calls
+	eventListen event = iota
+	eventDial
+	eventSuspend
+	eventResume
+	// Segments from the peer that passed validation
+	eventSyn
+	eventSynAck
+	eventRst
+	eventSegment
+	// Local failures and timeouts
+	eventRetransmissionLimit
+	eventReset
+)
+
+var eventNames = [...]string{
+	eventListen:              "Listen",
+	eventDial:                "Dial",
+	eventSuspend:             "Suspend",
+	eventResume:              "Resume",
+	eventSyn:                 "SYN",
+	eventSynAck:              "SYN ACK",
+	eventRst:                 "RST",
+	eventSegment:             "segment",
+	eventRetransmissionLimit: "retransmission limit",
+	eventReset:               "reset",
+}
+
+func (self event) String() string {
+	return eventNames[self]
+}
+
+// segmentEvent is the event for a validated segment
+func segmentEvent(segment *segment) event {
+	switch {
+
+	case segment.RST:
+		return eventRst
+
+	case segment.SYN && segment.ACK:
+		return eventSynAck
+
+	case segment.SYN:
+		return eventSyn
+
+	}
+
+	return eventSegment
+}
+
+// guard selects between transitions for the same state and event
+type guard struct {
+	name string
+	test func(self *conn, segment *segment) bool
+}
+
+var (
+	configAccepted = &guard{"config accepted", func(self *conn, segment *segment) bool {
+		if self.config != nil {
+			return true
+		}
+		_, err := self.handshakeConfig(segment)
+		return err == nil
+	}}
+	configRejected = &guard{"config rejected", func(self *conn, segment *segment) bool {
+		return !configAccepted.test(self, segment)
+	}}
+	autoResetAllowed = &guard{"auto reset allowed", func(self *conn, segment *segment) bool {
+		return self.canAutoReset()
+	}}
+	autoResetExhausted = &guard{"auto reset exhausted", func(self *conn, segment *segment) bool {
+		return !self.canAutoReset()
+	}}
+)
+
+// action is run by a transition with the segment or error behind its event.
+// An error returned by an action is returned from the event.
+type action func(self *conn, segment *segment, err error) error
+
+// do runs a conn method as an action
+func do(method func(*conn)) action {
+	return func(self *conn, segment *segment, err error) error {
+		method(self)
+		return nil
+	}
+}
+
+// transition is a row of the state transition table. The before actions run
+// in the current state, then the next state is entered and the after actions
+// run.
+type transition struct {
+	from   State
+	event  event
+	guard  *guard
+	before []action
+	to     State
+	after  []action
+}
+
+// The table is built in init as its actions refer back to it through fire
+var transitions []transition
+
+func init() {
+	opened := []action{do((*conn).armRetransmissionTimer), do((*conn).armNulTimer), do((*conn).startPathSearch), do((*conn).notifyOpen), do((*conn).wakeWriters)}
+	synSent := []action{do((*conn).sendSyn), do((*conn).armRetransmissionTimer)}
+	resetByPeer := []action{closeResetByPeer}
+	abort := []action{resetPeer}
+
+	transitions = []transition{
+		{from: StateClosed, event: eventListen, to: StateListen},
+		{from: StateClosed, event: eventDial, before: []action{do((*conn).setClient)}, to: StateSynSent, after: synSent},
+		{from: StateClosed, event: eventResume, to: StateOpen, after: append(opened, do((*conn).resendTxBuffer), do((*conn).announceResume))},
+		{from: StateClosed, event: eventReset, before: []action{answerStale}, to: StateClosed},
+
+		{from: StateListen, event: eventSyn, guard: configAccepted, before: []action{syncPeer, negotiateHandshake}, to: StateSynReceived, after: synSent},
+		{from: StateListen, event: eventSyn, guard: configRejected, before: []action{syncPeer, rejectConfig}, to: StateClosed},
+		{from: StateListen, event: eventReset, before: abort, to: StateClosed},
+
+		{from: StateSynSent, event: eventSyn, guard: configAccepted, before: []action{syncPeer, negotiateHandshake}, to: StateSynReceived, after: synSent},
+		{from: StateSynSent, event: eventSyn, guard: configRejected, before: []action{syncPeer, rejectConfig}, to: StateClosed},
+		{from: StateSynSent, event: eventSynAck, guard: configAccepted, before: []action{syncPeer, negotiateHandshake, do((*conn).measureHandshakeRtt)}, to: StateOpen, after: append(opened, do((*conn).sendAck))},
+		{from: StateSynSent, event: eventSynAck, guard: configRejected, before: []action{syncPeer, rejectConfig}, to: StateClosed},
+		{from: StateSynSent, event: eventRst, before: resetByPeer, to: StateClosed},
+		{from: StateSynSent, event: eventRetransmissionLimit, before: abort, to: StateClosed},
+		{from: StateSynSent, event: eventReset, before: abort, to: StateClosed},
+
+		{from: StateSynReceived, event: eventSegment, before: []action{do((*conn).measureHandshakeRtt)}, to: StateOpen, after: append(opened, process)},
+		{from: StateSynReceived, event: eventRst, before: resetByPeer, to: StateClosed},
+		{from: StateSynReceived, event: eventRetransmissionLimit, before: abort, to: StateClosed},
+		{from: StateSynReceived, event: eventReset, before: abort, to: StateClosed},
+
+		{from: StateOpen, event: eventSegment, to: StateOpen, after: []action{process}},
+		{from: StateOpen, event: eventSyn, before: []action{syncPeer, autoResetByPeer}, to: StateSynReceived, after: synSent},
+		{from: StateOpen, event: eventRst, before: resetByPeer, to: StateClosed},
+		{from: StateOpen, event: eventRetransmissionLimit, guard: autoResetAllowed, before: []action{autoResetLocally}, to: StateSynSent, after: synSent},
+		{from: StateOpen, event: eventRetransmissionLimit, guard: autoResetExhausted, before: abort, to: StateClosed},
+		{from: StateOpen, event: eventReset, before: abort, to: StateClosed},
+		{from: StateOpen, event: eventSuspend, before: []action{closeQuietly}, to: StateClosed},
+
+		{from: StateCloseWait, event: eventRst, before: resetByPeer, to: StateClosed},
+	}
+}
+
+// fire runs the transition for event from the current state. Events without
+// a transition are ignored.
+func (self *conn) fire(event event, segment *segment, err error) error {
+	for _, transition := range transitions {
+		if transition.from != self.state || transition.event != event {
+			continue
+		}
+
+		if transition.guard != nil && !transition.guard.test(self, segment) {
+			continue
+		}
+
+		var result error
+		run := func(actions []action) {
+			for _, action := range actions {
+				if actionErr := action(self, segment, err); actionErr != nil && result == nil {
+					result = actionErr
+				}
+			}
+		}
+
+		run(transition.before)
+		self.setState(transition.to)
+		run(transition.after)
+
+		return result
+	}
+
+	return nil
+}
+
+// Actions
+
+func syncPeer(self *conn, segment *segment, err error) error {
+	self.rxLastInSeq = segment.SeqNumber
+	self.rxSequenceStart = segment.SeqNumber
+	return nil
+}
+
+// negotiateHandshake settles the config from the peer's SYN. The config and
+// identifier from the initial handshake are kept across auto resets.
+func negotiateHandshake(self *conn, segment *segment, err error) error {
+	if self.config != nil {
+		return nil
+	}
+
+	self.config, _ = self.handshakeConfig(segment)
+	self.rxInitialSeq = self.rxLastInSeq
+	self.id = connID(self.client, self.txNextSeq-1, self.rxLastInSeq)
+	return nil
+}
+
+func rejectConfig(self *conn, segment *segment, err error) error {
+	_, err = self.handshakeConfig(segment)
+	self.reset(err)
+	return err
+}
+
+func process(self *conn, segment *segment, err error) error {
+	self.processSegment(segment)
+	return nil
+}
+
+func closeResetByPeer(self *conn, segment *segment, err error) error {
+	self.closed(resetError(segment))
+	return nil
+}
+
+// resetPeer closes the connection with err, resetting the peer
+func resetPeer(self *conn, segment *segment, err error) error {
+	self.reset(err)
+	return nil
+}
+
+// answerStale resets a peer still using the previous connection
+func answerStale(self *conn, segment *segment, err error) error {
+	self.sendRst(resetReason(err))
+	return nil
+}
+
+// closeQuietly closes the connection with err without notifying the peer
+func closeQuietly(self *conn, segment *segment, err error) error {
+	self.closed(err)
+	return nil
+}
+
+func autoResetByPeer(self *conn, segment *segment, err error) error {
+	self.autoReset(ErrConnectionReset)
+	return nil
+}
+
+func autoResetLocally(self *conn, segment *segment, err error) error {
+	self.autoReset(err)
+	return nil
+}
+
+func (self *conn) setClient() {
+	self.client = true
+}
+
+func (self *conn) notifyOpen() {
+	self.notify(func(handler Handler) { handler.OnOpen() })
+}
+
+// stateDiagram renders the transition table in Graphviz DOT or, with
+// mermaid set, as a Mermaid state diagram
+func stateDiagram(mermaid bool) string {
+	var diagram strings.Builder
+	if mermaid {
+		diagram.WriteString("stateDiagram-v2\n")
+		fmt.Fprintf(&diagram, "    [*] --> %s\n", stateName(StateClosed))
+	} else {
+		diagram.WriteString("digraph psst {\n")
+		fmt.Fprintf(&diagram, "    node [shape=box];\n")
+	}
+
+	for _, transition := range transitions {
+		label := transition.event.String()
+		if transition.guard != nil {
+			label += " [" + transition.guard.name + "]"
+		}
+
+		if mermaid {
+			fmt.Fprintf(&diagram, "    %s --> %s: %s\n", stateName(transition.from), stateName(transition.to), label)
+		} else {
+			fmt.Fprintf(&diagram, "    %s -> %s [label=%q];\n", stateName(transition.from), stateName(transition.to), label)
+		}
+	}
+
+	if !mermaid {
+		diagram.WriteString("}\n")
+	}
+
+	return diagram.String()
+}
+
+func stateName(state State) string {
+	return strings.TrimPrefix(state.String(), "State")
+}
@@ -0,0 +1,85 @@
+package psst
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the state diagrams in doc")
+
+func TestTransitionTable(t *testing.T) {
+	states := []State{StateClosed, StateListen, StateSynSent, StateSynReceived, StateOpen, StateCloseWait}
+
+	// States nothing enters yet, with the reason
+	unentered := map[State]string{
+		StateCloseWait: "entered once connections can be closed gracefully, the protocol already defines its RST handling",
+	}
+
+	// Every state is reachable from StateClosed
+	reachable := map[State]bool{StateClosed: true}
+	for changed := true; changed; {
+		changed = false
+		for _, transition := range transitions {
+			if reachable[transition.from] && !reachable[transition.to] {
+				reachable[transition.to] = true
+				changed = true
+			}
+		}
+	}
+
+	for _, state := range states {
+		if reason, ok := unentered[state]; ok {
+			if reachable[state] {
+				t.Errorf("%v is reachable, drop its exemption (%s)", state, reason)
+			}
+			continue
+		}
+
+		if !reachable[state] {
+			t.Errorf("%v is unreachable", state)
+		}
+	}
+
+	// Every state has a way out
+	for _, state := range states {
+		exit := false
+		for _, transition := range transitions {
+			if transition.from == state && transition.to != state {
+				exit = true
+			}
+		}
+
+		if !exit {
+			t.Errorf("%v has no transition out", state)
+		}
+	}
+
+	// Transitions for the same state and event are told apart by guards
+	for i, a := range transitions {
+		for _, b := range transitions[i+1:] {
+			if a.from == b.from && a.event == b.event && (a.guard == nil || b.guard == nil || a.guard == b.guard) {
+				t.Errorf("Transitions from %v on %v are ambiguous", a.from, a.event)
+			}
+		}
+	}
+}
+
+func TestStateDiagrams(t *testing.T) {
+	for name, mermaid := range map[string]bool{"states.dot": false, "states.mmd": true} {
+		path := filepath.Join("doc", name)
+		diagram := stateDiagram(mermaid)
+
+		if *update {
+			if err := os.WriteFile(path, []byte(diagram), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		if committed, err := os.ReadFile(path); err != nil || string(committed) != diagram {
+			t.Errorf("%s is out of date with the transition table, run go generate", path)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package psst
+
+import (
+	"time"
+)
+
+// Transport carries serialised segments to the peer, typically as PSS
+// messages. Segments received from the peer are passed to Receive.
+//
+// Send is called with the conn's internal lock held, so it must not call
+// back into the conn and should not block. Send errors are treated like lost
+// segments and recovered from by retransmission.
+type Transport interface {
+	Send(data []byte) error
+}
+
+// Receive processes a serialised segment received from the peer
+func (self *conn) Receive(data []byte) error {
+	segment := &segment{}
+	if err := segment.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	return self.receiveSegment(segment)
+}
+
+func (self *conn) sendSegment(segment *segment) {
+	self.advertiseWindow(segment)
+
+	data, err := segment.MarshalBinary()
+	if err != nil {
+		return
+	}
+
+	if segment.ACK {
+		self.acknowledged()
+	}
+
+	self.lastSent = time.Now()
+	self.stats.SegmentsSent++
+	self.stats.BytesSent += uint64(len(segment.Data))
+	if segment.EAK {
+		self.stats.EaksSent++
+	}
+
+	self.transport.Send(data)
+}
+
+// sendSyn sends the local config, or the negotiated config once the peer's
+// SYN has been received
+func (self *conn) sendSyn() {
+	synHeader := self.localConfig.synHeader()
+	if self.config != nil {
+		synHeader = self.config.synHeader()
+	}
+
+	self.synSentAt = time.Now()
+	self.sendSegment(&segment{
+		SYN:       true,
+		ACK:       self.state == StateSynReceived,
+		SeqNumber: self.txNextSeq - 1,
+		AckNumber: self.rxLastInSeq,
+		VarHeader: synHeader,
+	})
+}
+
+func (self *conn) sendAck() {
+	segment := &segment{
+		ACK:       true,
+		SeqNumber: self.txNextSeq,
+		AckNumber: self.rxLastInSeq,
+	}
+
+	self.attachEaks(segment)
+	self.sendSegment(segment)
+}
+
+func (self *conn) sendRst(reason string) {
+	self.sendSegment(&segment{
+		RST:       true,
+		SeqNumber: self.txNextSeq,
+		AckNumber: self.rxLastInSeq,
+		Data:      []byte(reason),
+	})
+}
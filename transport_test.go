@@ -0,0 +1,311 @@
+package psst
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testTransport struct {
+	mutex    sync.Mutex
+	segments []*segment
+}
+
+func (self *testTransport) Send(data []byte) error {
+	segment := &segment{}
+	if err := segment.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.segments = append(self.segments, segment)
+	return nil
+}
+
+func (self *testTransport) take() []*segment {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	segments := self.segments
+	self.segments = nil
+	return segments
+}
+
+// peerTransport is a testTransport that identifies its peer and the local
+// address the peer reaches it at
+type peerTransport struct {
+	testTransport
+	peer  string
+	local string
+}
+
+func (self *peerTransport) Peer() string {
+	return self.peer
+}
+
+func (self *peerTransport) LocalAddress() string {
+	return self.local
+}
+
+// segmentTaker is a test transport holding the segments sent over it
+type segmentTaker interface {
+	take() []*segment
+}
+
+// exchange delivers segments sent between two conns until both go quiet
+func exchange(a, b *conn, t *testing.T) {
+	for {
+		aSegments := a.transport.(segmentTaker).take()
+		bSegments := b.transport.(segmentTaker).take()
+
+		if len(aSegments) == 0 && len(bSegments) == 0 {
+			return
+		}
+
+		for _, segment := range aSegments {
+			b.Receive(marshalSegment(segment, t))
+		}
+
+		for _, segment := range bSegments {
+			a.Receive(marshalSegment(segment, t))
+		}
+	}
+}
+
+func TestValidationResponses(t *testing.T) {
+	quiet := func(rxLastInSeq uint16) *quietPeriod {
+		return &quietPeriod{until: time.Now().Add(time.Minute), rxLastInSeq: rxLastInSeq, peer: true, window: 20}
+	}
+
+	// A case for every reject in validateSegment, with the setup it needs
+	input := []struct {
+		state State
+		setup func(conn *conn)
+		*segment
+		Action
+		err error
+	}{
+		{StateClosed, func(conn *conn) { conn.quiet = quiet(0) }, &segment{ACK: true, SeqNumber: 1, AckNumber: 0x1233}, ActionReset, ErrStaleSegment},
+		{StateClosed, nil, &segment{ACK: true, SeqNumber: 1, AckNumber: 0x1233}, ActionDiscard, ErrUnexpectedSegment},
+		{StateListen, nil, &segment{ACK: true, SeqNumber: 1, AckNumber: 0x1233}, ActionDiscard, ErrInvalidFlags},
+		{StateListen, nil, &segment{SYN: true, ACK: true, SeqNumber: 1, AckNumber: 0x1233, VarHeader: &synVarHeader{}}, ActionDiscard, ErrInvalidFlags},
+		{StateListen, func(conn *conn) { conn.closedPeriods = []*quietPeriod{quiet(0x4000)} }, &segment{SYN: true, SeqNumber: 0x4001, VarHeader: &synVarHeader{}}, ActionDiscard, ErrStaleSegment},
+		{StateSynSent, nil, &segment{NUL: true, SeqNumber: 1}, ActionDiscard, ErrInvalidFlags},
+		{StateSynSent, func(conn *conn) { conn.config = nil; conn.closedPeriods = []*quietPeriod{quiet(0x4000)} }, &segment{SYN: true, SeqNumber: 0x4001, VarHeader: &synVarHeader{}}, ActionDiscard, ErrStaleSegment},
+		{StateSynSent, nil, &segment{SYN: true, ACK: true, SeqNumber: 1, AckNumber: 0x1234, VarHeader: &synVarHeader{}}, ActionReset, ErrInitialAckMismatch},
+		{StateSynSent, func(conn *conn) { conn.client = true }, &segment{SYN: true, SeqNumber: 1, VarHeader: &synVarHeader{}}, ActionDiscard, ErrInvalidFlags},
+		{StateSynReceived, nil, &segment{SYN: true, SeqNumber: 1, VarHeader: &synVarHeader{}}, ActionReset, ErrInvalidFlags},
+		{StateSynReceived, nil, &segment{ACK: true, EAK: true, SeqNumber: 1, AckNumber: 0x1233, VarHeader: &eakVarHeader{EakNumbers: []uint16{0x1233}}}, ActionReset, ErrInvalidFlags},
+		{StateSynReceived, nil, &segment{ACK: true, SeqNumber: 30, AckNumber: 0x1233, Data: []byte{0}}, ActionAck, ErrUnexpectedSeqNumber},
+		{StateSynReceived, nil, &segment{SeqNumber: 1, Data: []byte{0}}, ActionDiscard, ErrInitialAckMissing},
+		{StateSynReceived, nil, &segment{ACK: true, SeqNumber: 1, AckNumber: 0x1234}, ActionReset, ErrInitialAckMismatch},
+		{StateSynReceived, nil, &segment{ACK: true, SeqNumber: 1, AckNumber: 0x1233, Data: make([]byte, 1025)}, ActionDiscard, ErrOversizeSegment},
+		{StateOpen, nil, &segment{ACK: true, SeqNumber: 0, AckNumber: 0x1233}, ActionAck, ErrUnexpectedSeqNumber},
+		{StateOpen, nil, &segment{ACK: true, SeqNumber: 30, AckNumber: 0x1233, Data: []byte{0}}, ActionAck, ErrUnexpectedSeqNumber},
+		{StateOpen, nil, &segment{SYN: true, SeqNumber: 1, VarHeader: &synVarHeader{}}, ActionReset, ErrInvalidFlags},
+		{StateOpen, nil, &segment{NUL: true, SeqNumber: 1, Data: []byte{0}}, ActionDiscard, ErrNulWithData},
+		{StateOpen, nil, &segment{PRB: true, NUL: true, SeqNumber: 1}, ActionDiscard, ErrInvalidFlags},
+		{StateOpen, nil, &segment{SeqNumber: 1, Data: make([]byte, 1025)}, ActionDiscard, ErrOversizeSegment},
+		{StateOpen, nil, &segment{TCS: true, ACK: true, NUL: true, SeqNumber: 1, AckNumber: 0x1233, VarHeader: &tcsVarHeader{}}, ActionDiscard, ErrInvalidFlags},
+		{StateOpen, nil, &segment{TCS: true, ACK: true, SeqNumber: 1, AckNumber: 0x1233, VarHeader: &tcsVarHeader{}}, ActionDiscard, ErrInvalidTransfer},
+		{StateOpen, nil, &segment{ACK: true, SeqNumber: 1, AckNumber: 0x1234}, ActionDiscard, ErrAckUnsent},
+		{StateOpen, nil, &segment{EAK: true, SeqNumber: 1, VarHeader: &eakVarHeader{EakNumbers: []uint16{0x122c}}}, ActionDiscard, ErrInvalidFlags},
+		{StateOpen, nil, &segment{ACK: true, EAK: true, SeqNumber: 1, AckNumber: 0x122a}, ActionReset, ErrMissingEakHeader},
+		{StateOpen, nil, &segment{ACK: true, EAK: true, SeqNumber: 1, AckNumber: 0x122f, VarHeader: &eakVarHeader{EakNumbers: []uint16{0x122c}}}, ActionDiscard, ErrEakBelowAck},
+		{StateOpen, nil, &segment{ACK: true, EAK: true, SeqNumber: 1, AckNumber: 0x122a, VarHeader: &eakVarHeader{EakNumbers: []uint16{0x123e}}}, ActionDiscard, ErrEakUnsent},
+		{StateCloseWait, nil, &segment{NUL: true, SeqNumber: 1}, ActionDiscard, ErrUnexpectedSegment},
+	}
+
+	// Every reject has a case, bar SYNs without a header which fail to
+	// deserialise before they are validated
+	errorNames := validationErrorNames(t)
+	missing := rejectCalls(t)
+	delete(missing, fmt.Sprintf("%v %v ErrMissingSynHeader", StateListen, ActionReset))
+	delete(missing, fmt.Sprintf("%v %v ErrMissingSynHeader", StateSynSent, ActionReset))
+	for _, i := range input {
+		missing[fmt.Sprintf("%v %v %v", i.state, i.Action, errorNames[i.err.Error()])]--
+	}
+
+	for reject, calls := range missing {
+		if calls > 0 {
+			t.Errorf("No response case for %s", reject)
+		}
+	}
+
+	for _, i := range input {
+		transport := &testTransport{}
+		conn := NewConn(transport)
+
+		conn.state = i.state
+		conn.config = defaultConfig()
+		conn.localConfig = DefaultConfig()
+		conn.txNextSeq = 0x1234
+		conn.txOldestUnacked = conn.txNextSeq - 10
+		conn.rxLastInSeq = 0
+		if i.setup != nil {
+			i.setup(conn)
+		}
+
+		err := conn.Receive(marshalSegment(i.segment, t))
+
+		var protocolError *ProtocolError
+		if !errors.As(err, &protocolError) || protocolError.Action != i.Action || protocolError.Err != i.err {
+			t.Fatalf("Segment %v in %v failed with %v, expected %v with %v", i.segment, i.state, err, i.Action, i.err)
+		}
+
+		switch i.Action {
+
+		case ActionDiscard:
+			if len(transport.segments) != 0 || conn.state != i.state {
+				t.Fatalf("Discarded segment %v in %v caused response %v and state %v", i.segment, i.state, transport.segments, conn.state)
+			}
+
+		case ActionAck:
+			if len(transport.segments) != 1 || conn.state != i.state {
+				t.Fatalf("Segment %v in %v caused responses %v and state %v, expected ACK", i.segment, i.state, transport.segments, conn.state)
+			}
+
+			// The SYN ACK is repeated until the handshake completes
+			response := transport.segments[0]
+			if !response.ACK || response.SYN != (i.state == StateSynReceived) || response.RST || response.AckNumber != 0 {
+				t.Fatalf("Segment %v in %v caused response %v, expected ACK 0", i.segment, i.state, response)
+			}
+
+		case ActionReset:
+			// A closed conn answers the peer without a connection to close
+			if len(transport.segments) != 1 || !transport.segments[0].RST || conn.state != StateClosed || i.state != StateClosed && conn.err != err {
+				t.Fatalf("Segment %v in %v caused responses %v and state %v, expected RST", i.segment, i.state, transport.segments, conn.state)
+			}
+
+		}
+
+		conn.mutex.Lock()
+		conn.stopTimers()
+		conn.unlock()
+	}
+}
+
+// rejectCalls counts the rejects in validateSegment by state, action and
+// error
+func rejectCalls(t *testing.T) map[string]int {
+	file, err := parser.ParseFile(token.NewFileSet(), "state.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(map[string]int)
+	for _, decl := range file.Decls {
+		if function, ok := decl.(*ast.FuncDecl); !ok || function.Name.Name != "validateSegment" {
+			continue
+		}
+
+		ast.Inspect(decl, func(node ast.Node) bool {
+			clause, ok := node.(*ast.CaseClause)
+			if !ok {
+				return true
+			}
+
+			ast.Inspect(clause, func(node ast.Node) bool {
+				if call, ok := node.(*ast.CallExpr); ok {
+					if selector, ok := call.Fun.(*ast.SelectorExpr); ok && selector.Sel.Name == "reject" {
+						calls[fmt.Sprintf("%v %v %v", clause.List[0], call.Args[0], call.Args[1])]++
+					}
+				}
+				return true
+			})
+			return false
+		})
+	}
+
+	if len(calls) == 0 {
+		t.Fatal("No rejects found in validateSegment")
+	}
+
+	return calls
+}
+
+// validationErrorNames maps the messages of the errors in errors.go to
+// their names
+func validationErrorNames(t *testing.T) map[string]string {
+	file, err := parser.ParseFile(token.NewFileSet(), "errors.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]string)
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.ValueSpec)
+		if !ok || len(spec.Values) != 1 {
+			return true
+		}
+
+		if call, ok := spec.Values[0].(*ast.CallExpr); ok && len(call.Args) == 1 {
+			if literal, ok := call.Args[0].(*ast.BasicLit); ok {
+				message, _ := strconv.Unquote(literal.Value)
+				names[message] = spec.Names[0].Name
+			}
+		}
+		return true
+	})
+
+	return names
+}
+
+func TestHandshakeResponses(t *testing.T) {
+	listenerTransport := &testTransport{}
+	listener := NewConn(listenerTransport)
+	listener.Listen(nil)
+
+	dialerTransport := &testTransport{}
+	dialer := NewConn(dialerTransport)
+	dialer.Dial(nil)
+
+	if len(dialerTransport.segments) != 1 || !dialerTransport.segments[0].SYN || dialerTransport.segments[0].SeqNumber != dialer.txNextSeq-1 {
+		t.Fatalf("Dial sent %v, expected SYN", dialerTransport.segments)
+	}
+
+	listener.Receive(marshalSegment(dialerTransport.segments[0], t))
+
+	if len(listenerTransport.segments) != 1 || listener.state != StateSynReceived {
+		t.Fatalf("Listener responded to SYN with %v in state %v", listenerTransport.segments, listener.state)
+	}
+
+	synAck := listenerTransport.segments[0]
+	if !synAck.SYN || !synAck.ACK || synAck.SeqNumber != listener.txNextSeq-1 || synAck.AckNumber != dialer.txNextSeq-1 {
+		t.Fatalf("Listener responded to SYN with %v, expected SYN ACK", synAck)
+	}
+
+	dialer.Receive(marshalSegment(synAck, t))
+
+	if len(dialerTransport.segments) != 2 || dialer.state != StateOpen {
+		t.Fatalf("Dialer responded to SYN ACK with %v in state %v", dialerTransport.segments, dialer.state)
+	}
+
+	ack := dialerTransport.segments[1]
+	if !ack.ACK || ack.SYN || ack.AckNumber != listener.txNextSeq-1 {
+		t.Fatalf("Dialer responded to SYN ACK with %v, expected ACK", ack)
+	}
+
+	listener.Receive(marshalSegment(ack, t))
+
+	if len(listenerTransport.segments) != 1 || listener.state != StateOpen {
+		t.Fatalf("Listener responded to ACK with %v in state %v", listenerTransport.segments[1:], listener.state)
+	}
+}
+
+func marshalSegment(segment *segment, t *testing.T) []byte {
+	data, err := segment.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to serialze segment: %v", err)
+	}
+
+	return data
+}
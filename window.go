@@ -0,0 +1,92 @@
+package psst
+
+import (
+	"time"
+)
+
+// Segments acknowledging data while the connection is open advertise the
+// live receive window, which shrinks as unread data queues up. The sender
+// keeps new data within the window the peer last advertised. While that
+// window is closed it probes the peer with NUL segments, which are accepted
+// regardless of the window and answered right away, so it learns when the
+// window opens even if the window update is lost.
+
+// advertiseWindow adds the receive window to an acknowledging segment
+func (self *conn) advertiseWindow(segment *segment) {
+	if !segment.ACK || segment.SYN || self.state != StateOpen {
+		return
+	}
+
+	segment.WND = true
+	segment.Window = self.rxWindow()
+	self.rxWindowClosed = segment.Window == 0
+}
+
+// updateWindow opens a closed receive window once the application has
+// read, so the peer doesn't have to wait for its next probe
+func (self *conn) updateWindow() {
+	if self.rxWindowClosed && self.state == StateOpen && self.rxWindow() > 0 {
+		self.sendAck()
+	}
+}
+
+// receivedWindow takes the window advertised by the peer as the sequence
+// number it ends at, so the window stays put as later ACKs arrive. Segments
+// acknowledging less than has been acknowledged already are delayed and
+// their window is out of date.
+func (self *conn) receivedWindow(segment *segment) {
+	// Check for negative unsigned diff AckNumber < txOldestUnacked
+	if diff := int16(segment.AckNumber - self.txOldestUnacked); !segment.WND || diff < 0 {
+		return
+	}
+
+	self.txWindowEdge = segment.AckNumber + segment.Window
+	self.txWindowAdvertised = true
+
+	if self.txWindowRoom() {
+		self.probes = 0
+		if self.probeTimer != nil {
+			self.probeTimer.Stop()
+			self.probeTimer = nil
+		}
+	}
+}
+
+// txWindowRoom reports whether the next sequence number is within the
+// window the peer advertised
+func (self *conn) txWindowRoom() bool {
+	if !self.txWindowAdvertised {
+		return true
+	}
+
+	// Check for non-positive unsigned diff txNextSeq <= txWindowEdge
+	return int16(self.txNextSeq-self.txWindowEdge) <= 0
+}
+
+// armProbeTimer schedules a probe of the peer's window when a writer is
+// waiting on it and no outstanding segment will bring an update. The
+// interval starts at the retransmission timeout and doubles with every
+// probe up to the NulTimeout.
+func (self *conn) armProbeTimer() {
+	if self.probeTimer != nil || self.state != StateOpen || !self.writeBlocked || self.txWindowRoom() || self.txBuffer.Len() > 0 {
+		return
+	}
+
+	delay := min(self.retransmissionTimeout()<<min(self.probes, 16), millisToDuration(self.config.NulTimeout))
+	self.probeTimer = time.AfterFunc(delay, self.probeTimerExpired)
+}
+
+func (self *conn) probeTimerExpired() {
+	self.mutex.Lock()
+	defer self.unlock()
+
+	self.probeTimer = nil
+
+	if self.state != StateOpen || self.txWindowRoom() || self.txBuffer.Len() > 0 {
+		return
+	}
+
+	self.probes++
+	self.stats.WindowProbes++
+	self.transmit(&txBufferEntry{nul: true})
+}
@@ -0,0 +1,115 @@
+package psst
+
+import (
+	"testing"
+)
+
+func TestWindowAdvertisement(t *testing.T) {
+	transport := &testTransport{}
+	conn := NewConn(transport)
+
+	conn.state = StateOpen
+	conn.config = defaultConfig()
+	conn.config.MaxOutstandingSegmentsSelf = 2
+	conn.rxLastInSeq = 0
+
+	conn.receiveSegment(&segment{SeqNumber: 1, Data: []byte{1}})
+	conn.receiveSegment(&segment{SeqNumber: 2, Data: []byte{2}})
+
+	conn.mutex.Lock()
+	conn.sendAck()
+	conn.unlock()
+
+	if segments := transport.take(); len(segments) != 1 || !segments[0].WND || segments[0].Window != 0 {
+		t.Fatalf("Sent %v with unread data filling the window, expected a closed window", segments)
+	}
+
+	// Reading opens the window right away
+	conn.ReadMessage()
+
+	if segments := transport.take(); len(segments) != 1 || !segments[0].WND || segments[0].Window != 1 || segments[0].AckNumber != 2 {
+		t.Fatalf("Sent %v once read, expected a window update", segments)
+	}
+
+	conn.ReadMessage()
+
+	if segments := transport.take(); len(segments) != 0 {
+		t.Fatalf("Sent %v with the window open, expected nothing", segments)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
+
+func TestZeroWindowProbe(t *testing.T) {
+	conn := windowConn()
+	conn.config.RetransmissionTimeout = 10
+	conn.config.CumulativeAckTimeout = 5
+	handler := &recordingHandler{}
+	conn.SetHandler(handler)
+	conn.SetNonBlocking(true)
+	transport := conn.transport.(*testTransport)
+
+	conn.Write([]byte{0})
+	conn.receiveSegment(&segment{ACK: true, WND: true, Window: 0, SeqNumber: 1, AckNumber: 1})
+
+	if err := conn.Write([]byte{1}); err != ErrWouldBlock {
+		t.Fatalf("Write failed with %v with the window closed, expected would block", err)
+	}
+
+	// The probe is a NUL beyond the closed window
+	segments, _ := waitSent(transport, 2, t)
+	if probe := segments[1]; !probe.NUL || probe.SeqNumber != 2 {
+		t.Fatalf("Sent %v, expected a NUL probe", segments)
+	}
+
+	conn.receiveSegment(&segment{ACK: true, WND: true, Window: 1, SeqNumber: 1, AckNumber: 2})
+
+	validateEvents(handler, []string{"ack 1", "ack 2", "writable"}, t)
+
+	if err := conn.Write([]byte{1}); err != nil {
+		t.Fatalf("Write failed with %v once the window opened", err)
+	}
+
+	if stats := conn.Stats(); stats.WindowProbes != 1 {
+		t.Fatalf("Stats %+v don't count the probe", stats)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}
+
+func TestStaleWindow(t *testing.T) {
+	conn := windowConn()
+	conn.config.MaxOutstandingSegmentsPeer = 10
+	conn.SetNonBlocking(true)
+
+	conn.Write([]byte{1})
+	conn.Write([]byte{2})
+	conn.receiveSegment(&segment{ACK: true, WND: true, Window: 1, SeqNumber: 1, AckNumber: 2})
+
+	if err := conn.Write([]byte{3}); err != nil {
+		t.Fatalf("Write failed with %v within the window", err)
+	}
+
+	// A delayed ACK doesn't move the window
+	conn.receiveSegment(&segment{ACK: true, WND: true, Window: 5, SeqNumber: 1, AckNumber: 1})
+
+	if err := conn.Write([]byte{4}); err != ErrWouldBlock {
+		t.Fatalf("Write failed with %v after a stale window, expected would block", err)
+	}
+
+	// Nor does an ACK without a window, the window ends where it was
+	// advertised
+	conn.receiveSegment(&segment{ACK: true, SeqNumber: 1, AckNumber: 3})
+
+	if err := conn.Write([]byte{4}); err != ErrWouldBlock {
+		t.Fatalf("Write failed with %v beyond the advertised window, expected would block", err)
+	}
+
+	conn.mutex.Lock()
+	conn.closed(nil)
+	conn.unlock()
+}